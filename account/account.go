@@ -8,14 +8,48 @@ import (
 
 // Account represents an account within the application. Account names
 // should be unique. The application should not directly modify AuthType,
-// AuthData, or Expires.
+// AuthData, Expires, History, or the failure tracking fields.
 type Account struct {
-	Name     string    // The account name
-	AuthType string    // The identifier for the mechanism by which the user's password is transformed and compared
-	AuthData []byte    // The authentication token, managed by the authentication mechanism
-	Locked   bool      // Whether or not the account is administratively locked
-	Expires  time.Time // The date and time after which the AuthData is expired
-	AuxData  []byte    // Arbitrary data the application stores with the Account
+	Name        string      // The account name
+	AuthType    string      // The identifier for the mechanism by which the user's password is transformed and compared
+	AuthData    []byte      // The authentication token, managed by the authentication mechanism
+	Locked      bool        // Whether or not the account is administratively locked
+	Expires     time.Time   // The date and time after which the AuthData is expired
+	AuxData     []byte      // Arbitrary data the application stores with the Account
+	Failures    int         // Failed authentication attempts since the last success, lockout, or expired window
+	LastFailure time.Time   // The date and time of the most recent failed authentication attempt
+	Lockouts    int         // Consecutive temporary lockouts since the last success
+	LockedUntil time.Time   // The date and time before which authentication attempts are refused
+	History     []Challenge // Previous challenges, most recent first
+}
+
+// Clone returns a deep copy of the Account, so that stores can hand out
+// Accounts that callers may modify freely.
+func (a *Account) Clone() *Account {
+	c := *a
+	c.AuthData = cloneBytes(a.AuthData)
+	c.AuxData = cloneBytes(a.AuxData)
+	if a.History != nil {
+		c.History = make([]Challenge, len(a.History))
+		for i, h := range a.History {
+			c.History[i] = Challenge{AuthType: h.AuthType, AuthData: cloneBytes(h.AuthData)}
+		}
+	}
+	return &c
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// Challenge is a previous authentication token and the mechanism that
+// produced it.
+type Challenge struct {
+	AuthType string // The identifier for the mechanism that produced AuthData
+	AuthData []byte // The authentication token
 }
 
 // Store collects the methods required of an underlying Account store.
@@ -27,6 +61,19 @@ type Store interface {
 	Rename(newname string, a *Account) error // Renames an account to the new name, replacing an existing Account and modifying the Account object to have the new name.
 }
 
+// Lister can be implemented by stores that are able to enumerate their
+// Accounts, for jobs that need to visit every Account.
+type Lister interface {
+	Names() ([]string, error) // List the names of all Accounts in storage
+}
+
+// Modifier can be implemented by stores that can change a stored Account
+// atomically. Get followed by Update loses changes made by others in
+// between, e.g. failures counted by parallel authentication attempts.
+type Modifier interface {
+	Modify(name string, f func(a *Account) bool) (*Account, error) // Apply f to the named Account, storing the change if f returns true
+}
+
 // NotFound can be implemented by errors in store packages to indicate that
 // an account is not found.
 type NotFound interface {
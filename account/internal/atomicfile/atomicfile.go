@@ -0,0 +1,44 @@
+// package atomicfile replaces files so that a crash or failed write never
+// leaves them partly written.
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Write replaces the file at path with data. The data is written to a
+// temporary file in the same directory and synced before it's renamed over
+// path, so path holds either the old or the new data even after a crash.
+func Write(path string, data []byte) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		// Keep the temporary file on the same filesystem as path.
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, base+".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// Make the rename itself durable. Not all platforms can sync a
+	// directory, so this is best effort.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	for _, data := range []string{"old", "new"} {
+		if err := Write(path, []byte(data)); err != nil {
+			t.Fatalf("unexpected error writing: %q", err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Fatalf("expected new contents, got %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("expected no temporary files left, got %d entries", len(entries))
+	}
+}
+
+func TestWriteRelative(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("unexpected error changing directory: %q", err)
+	}
+	defer os.Chdir(wd)
+	if err := Write("file", []byte("data")); err != nil {
+		t.Fatalf("unexpected error writing: %q", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "file")); string(data) != "data" {
+		t.Fatalf("expected file in the working directory, got %q", data)
+	}
+}
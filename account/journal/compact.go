@@ -0,0 +1,111 @@
+package journal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+	"github.com/AgentZombie/dontusepasswords/account/internal/atomicfile"
+)
+
+const snapshotName = "snapshot.json"
+
+// snapshot holds every Account as of record Seq.
+type snapshot struct {
+	Seq      uint64
+	Accounts map[string]*account.Account
+}
+
+func readSnapshot(dir string) (*snapshot, error) {
+	snap := &snapshot{}
+	data, err := os.ReadFile(filepath.Join(dir, snapshotName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "reading snapshot")
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, snap); err != nil {
+			return nil, errors.Wrap(err, "decoding snapshot")
+		}
+	}
+	if snap.Accounts == nil {
+		snap.Accounts = map[string]*account.Account{}
+	}
+	return snap, nil
+}
+
+// Compact writes a new snapshot of every Account and, unless
+// Options.KeepJournal is set, removes the journal files it replaces. New
+// records go to a new journal file, so changes can continue while the
+// snapshot is written. Compact is called in the background as the journal
+// grows and rarely needs to be called directly.
+func (s *Store) Compact() error {
+	s.compactLock.Lock()
+	defer s.compactLock.Unlock()
+
+	s.lock.Lock()
+	if s.released {
+		s.lock.Unlock()
+		return errClosed
+	}
+	if s.seq == s.snapSeq {
+		s.lock.Unlock()
+		return nil
+	}
+	snap := &snapshot{Seq: s.seq, Accounts: make(map[string]*account.Account, len(s.accounts))}
+	// Stored Accounts are never modified, only replaced, so they can be
+	// shared with the snapshot.
+	for name, a := range s.accounts {
+		snap.Accounts[name] = a
+	}
+	err := s.rotate()
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return errors.Wrap(err, "encoding snapshot")
+	}
+	if err := atomicfile.Write(filepath.Join(s.dir, snapshotName), data); err != nil {
+		return errors.Wrap(err, "writing snapshot")
+	}
+	s.lock.Lock()
+	s.snapSeq = snap.Seq
+	s.lock.Unlock()
+
+	if s.opts.KeepJournal {
+		return nil
+	}
+	starts, err := journals(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, start := range starts {
+		if start <= snap.Seq {
+			if err := os.Remove(journalPath(s.dir, start)); err != nil {
+				return errors.Wrap(err, "removing compacted journal")
+			}
+		}
+	}
+	return nil
+}
+
+// rotate starts a new journal file for the records after s.seq. The lock
+// must be held.
+func (s *Store) rotate() error {
+	fh, err := openJournal(s.dir, s.seq+1)
+	if err != nil {
+		return err
+	}
+	old := s.journal
+	s.journal, s.size = fh, 0
+	err = old.Sync()
+	if cerr := old.Close(); err == nil {
+		err = cerr
+	}
+	return errors.Wrap(err, "closing journal")
+}
@@ -0,0 +1,242 @@
+// package journal provides Account storage as an append-only journal of
+// changes, so that updating an Account costs a small append rather than
+// rewriting every Account. A store is kept in a directory:
+//
+//	snapshot.json        every Account as of some journal record
+//	journal-<seq>.jsonl  change records from record <seq> on, one per line
+//
+// The journal is replayed over the snapshot when a store is opened, and is
+// compacted into a new snapshot in the background as it grows. A directory
+// must only be used by one Store at a time.
+package journal
+
+import (
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+)
+
+const (
+	DefaultCompactAfter = 1000 // Records written between compactions if not set in Options
+)
+
+// Options configure how a Store is opened and compacted.
+type Options struct {
+	Create       bool        // Create an empty store if the directory doesn't exist
+	CompactAfter int         // Records written between compactions; zero uses DefaultCompactAfter
+	KeepJournal  bool        // Keep compacted journal files for History rather than removing them
+	Logger       *log.Logger // Receives warnings, e.g. a truncated journal; nil uses the standard logger
+}
+
+var errClosed = errors.New("journal store closed")
+
+// Store holds the Account objects and records changes to them in the
+// journal. A Store is safe for concurrent use. Accounts are copied in and
+// out of the Store, so changes to an Account returned by Get aren't seen by
+// the Store or other callers until it's passed to Update.
+type Store struct {
+	dir  string
+	opts Options
+
+	lock        sync.RWMutex // Guards the fields below
+	accounts    map[string]*account.Account
+	seq         uint64   // Last record written
+	snapSeq     uint64   // Last record in the snapshot
+	nextCompact uint64   // Record after which to compact
+	journal     *os.File // Current journal file, open for appending
+	size        int64    // Length of the current journal file
+	failed      error    // Why writes are refused, if a failed write couldn't be undone
+	closed      bool     // Whether changes are refused
+	released    bool     // Whether the journal file is closed
+
+	compactLock sync.Mutex // Serializes compactions
+	compactions sync.WaitGroup
+}
+
+// Open opens the store in directory dir, replaying its journal. A record
+// that was only partly written at the end of the journal, e.g. because of a
+// crash, is discarded with a warning; other damage to the journal, including
+// a complete final record that fails its checksum, is an error. Close must
+// be called when the Store is no longer needed.
+func Open(dir string, o Options) (*Store, error) {
+	if o.CompactAfter < 0 {
+		return nil, errors.New("negative journal compaction interval")
+	}
+	if o.CompactAfter == 0 {
+		o.CompactAfter = DefaultCompactAfter
+	}
+	if o.Logger == nil {
+		o.Logger = log.Default()
+	}
+	if o.Create {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, errors.Wrap(err, "creating journal directory")
+		}
+	}
+	snap, err := readSnapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+	starts, err := journals(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:      dir,
+		opts:     o,
+		accounts: snap.Accounts,
+		seq:      snap.Seq,
+		snapSeq:  snap.Seq,
+	}
+	for i, start := range starts {
+		if i+1 < len(starts) && starts[i+1] <= snap.Seq+1 {
+			// Every record in this file is in the snapshot.
+			continue
+		}
+		if err := s.replay(start, i == len(starts)-1); err != nil {
+			return nil, err
+		}
+	}
+	s.nextCompact = s.seq + uint64(o.CompactAfter)
+
+	start := s.seq + 1
+	if len(starts) > 0 && starts[len(starts)-1] <= start {
+		start = starts[len(starts)-1]
+	}
+	if s.journal, err = openJournal(dir, start); err != nil {
+		return nil, err
+	}
+	fi, err := s.journal.Stat()
+	if err != nil {
+		s.journal.Close()
+		return nil, errors.Wrap(err, "opening journal")
+	}
+	s.size = fi.Size()
+	return s, nil
+}
+
+// Close waits for any compactions that have been started to finish and
+// closes the journal. Changes can't be made after a Store is closed.
+func (s *Store) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.lock.Unlock()
+	s.compactions.Wait()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.released = true
+	err := s.journal.Sync()
+	if cerr := s.journal.Close(); err == nil {
+		err = cerr
+	}
+	return errors.Wrap(err, "closing journal")
+}
+
+// Get retrieves a copy of an Account object by name.
+func (s *Store) Get(name string) (*account.Account, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if a, ok := s.accounts[name]; ok {
+		return a.Clone(), nil
+	}
+	return nil, &account.NotFoundError{Str: "not found"}
+}
+
+// Names returns the names of all Accounts in the store, sorted.
+func (s *Store) Names() ([]string, error) {
+	s.lock.RLock()
+	names := make([]string, 0, len(s.accounts))
+	for name := range s.accounts {
+		names = append(names, name)
+	}
+	s.lock.RUnlock()
+	sort.Strings(names)
+	return names, nil
+}
+
+// Update records a copy of a in the journal.
+func (s *Store) Update(a *account.Account) error {
+	return s.write(Record{Op: OpUpdate, Name: a.Name, Account: a.Clone()})
+}
+
+// Delete records the removal of an Account in the journal.
+func (s *Store) Delete(name string) error {
+	return s.write(Record{Op: OpDelete, Name: name})
+}
+
+// Rename records in the journal that an Account has moved to a new name,
+// replacing an Account if one already exists with the new name. The Account
+// object is modified to receive the new name.
+func (s *Store) Rename(newname string, a *account.Account) error {
+	c := a.Clone()
+	c.Name = newname
+	if err := s.write(Record{Op: OpRename, Name: a.Name, NewName: newname, Account: c}); err != nil {
+		return err
+	}
+	a.Name = newname
+	return nil
+}
+
+// Flush makes the records written so far durable. Records are written to
+// the journal as changes are made, so only a sync is needed.
+func (s *Store) Flush() error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.released {
+		return errClosed
+	}
+	return errors.Wrap(s.journal.Sync(), "syncing journal")
+}
+
+// write appends r to the journal and applies it, starting a compaction in
+// the background if enough records have been written since the last one.
+func (s *Store) write(r Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return errClosed
+	}
+	if s.failed != nil {
+		return s.failed
+	}
+	r.Seq = s.seq + 1
+	r.Time = time.Now().UTC()
+	line, err := r.encode()
+	if err != nil {
+		return errors.Wrap(err, "encoding journal record")
+	}
+	if _, err := s.journal.Write(line); err != nil {
+		// Don't leave part of a record for later records to follow. If
+		// that fails, refuse further writes; reopening the store discards
+		// the partial record.
+		if terr := s.journal.Truncate(s.size); terr != nil {
+			s.failed = errors.Wrap(terr, "journal damaged by failed write")
+		}
+		return errors.Wrap(err, "writing journal")
+	}
+	s.size += int64(len(line))
+	s.seq = r.Seq
+	r.apply(s.accounts)
+
+	if s.seq >= s.nextCompact {
+		s.nextCompact = s.seq + uint64(s.opts.CompactAfter)
+		s.compactions.Add(1)
+		go func() {
+			defer s.compactions.Done()
+			if err := s.Compact(); err != nil && err != errClosed {
+				s.opts.Logger.Printf("warning: compacting journal: %s", err)
+			}
+		}()
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package journal
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+	"github.com/AgentZombie/dontusepasswords/account/storetest"
+)
+
+func open(t *testing.T, dir string, o Options) *Store {
+	s, err := Open(dir, o)
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %q", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+var factory = storetest.Factory{
+	New: func(t *testing.T) account.Store {
+		return open(t, t.TempDir(), Options{Create: true, CompactAfter: 16})
+	},
+	Reopen: func(t *testing.T, s account.Store) account.Store {
+		return open(t, s.(*Store).dir, Options{})
+	},
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, factory)
+}
+
+func TestConcurrent(t *testing.T) {
+	storetest.RunConcurrent(t, factory)
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, Options{Create: true})
+	s.Update(&account.Account{Name: "user", Failures: 1})
+	s.Update(&account.Account{Name: "user", Failures: 2})
+	s.Rename("renamed", &account.Account{Name: "user", Failures: 3})
+	s.Update(&account.Account{Name: "deleted"})
+	s.Delete("deleted")
+	if err := s.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %q", err)
+	}
+
+	// Simulate a crash part way through writing a record.
+	path := journalPath(dir, 1)
+	fh, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	fh.WriteString(`{"CRC":1234,"Record":{"Seq":6,`)
+	fh.Close()
+
+	buf := &bytes.Buffer{}
+	r := open(t, dir, Options{Logger: log.New(buf, "", 0)})
+	names, _ := r.Names()
+	if strings.Join(names, ",") != "renamed" {
+		t.Fatalf("expected replayed accounts [renamed], got %v", names)
+	}
+	if a, _ := r.Get("renamed"); a.Failures != 3 {
+		t.Fatalf("expected replayed failures 3, got %d", a.Failures)
+	}
+	if !strings.Contains(buf.String(), "incomplete record") {
+		t.Fatalf("expected warning about incomplete record, got %q", buf.String())
+	}
+	if err := r.Update(&account.Account{Name: "after"}); err != nil {
+		t.Fatalf("unexpected error updating: %q", err)
+	}
+	r.Close()
+	if a, err := open(t, dir, Options{}).Get("after"); err != nil || a.Name != "after" {
+		t.Fatalf("expected record written after truncation, got %v", err)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, Options{Create: true})
+	for _, name := range []string{"a", "b", "c"} {
+		s.Update(&account.Account{Name: name})
+	}
+	s.Close()
+
+	path := journalPath(dir, 1)
+	data, _ := os.ReadFile(path)
+	data = bytes.Replace(data, []byte(`"Name":"b"`), []byte(`"Name":"x"`), 1)
+	os.WriteFile(path, data, 0600)
+	if _, err := Open(dir, Options{}); err == nil {
+		t.Fatal("expected error opening journal with corrupt record")
+	}
+
+	// A complete last record that fails its checksum isn't a torn write.
+	data = bytes.Replace(data, []byte(`"Name":"x"`), []byte(`"Name":"b"`), 1)
+	data = bytes.Replace(data, []byte(`"Name":"c"`), []byte(`"Name":"y"`), 1)
+	os.WriteFile(path, data, 0600)
+	if _, err := Open(dir, Options{}); err == nil {
+		t.Fatal("expected error opening journal with corrupt last record")
+	}
+}
+
+func TestFailedWrite(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, Options{Create: true})
+	s.Update(&account.Account{Name: "a"})
+
+	// A read-only handle can neither be written nor truncated.
+	journal := s.journal
+	ro, err := os.Open(journalPath(dir, 1))
+	if err != nil {
+		t.Fatalf("unexpected error opening journal: %q", err)
+	}
+	s.journal = ro
+	if err := s.Update(&account.Account{Name: "b"}); err == nil {
+		t.Fatal("expected error writing journal")
+	}
+	s.journal = journal
+	ro.Close()
+	if err := s.Update(&account.Account{Name: "c"}); err == nil {
+		t.Fatal("expected writes to be refused after a failed write couldn't be undone")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, Options{Create: true, CompactAfter: 1000})
+	for i := 0; i < 10; i++ {
+		s.Update(&account.Account{Name: "user", Failures: i})
+	}
+	s.Delete("user")
+	s.Update(&account.Account{Name: "kept"})
+	if err := s.Compact(); err != nil {
+		t.Fatalf("unexpected error compacting: %q", err)
+	}
+	s.Update(&account.Account{Name: "after"})
+	if starts, _ := journals(dir); len(starts) != 1 || starts[0] != 13 {
+		t.Fatalf("expected only journal starting at 13 after compaction, got %v", starts)
+	}
+	s.Close()
+
+	names, _ := open(t, dir, Options{}).Names()
+	if strings.Join(names, ",") != "after,kept" {
+		t.Fatalf("expected accounts [after kept] after compaction, got %v", names)
+	}
+}
+
+func TestBackgroundCompact(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, Options{Create: true, CompactAfter: 5})
+	for i := 0; i < 23; i++ {
+		s.Update(&account.Account{Name: "user", Failures: i})
+	}
+	s.Close()
+	snap, err := readSnapshot(dir)
+	if err != nil {
+		t.Fatalf("unexpected error reading snapshot: %q", err)
+	}
+	// A compaction snapshots whatever has been written when it runs.
+	if snap.Seq < 20 {
+		t.Fatalf("expected snapshot at record 20 or later, got %d", snap.Seq)
+	}
+	if a, _ := open(t, dir, Options{}).Get("user"); a.Failures != 22 {
+		t.Fatalf("expected failures 22, got %d", a.Failures)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, Options{Create: true, KeepJournal: true})
+	s.Update(&account.Account{Name: "old"})
+	s.Update(&account.Account{Name: "other"})
+	s.Compact()
+	s.Rename("new", &account.Account{Name: "old"})
+	s.Update(&account.Account{Name: "new", Failures: 1})
+
+	history, err := s.History("new")
+	if err != nil {
+		t.Fatalf("unexpected error reading history: %q", err)
+	}
+	if len(history) != 2 || history[0].Op != OpRename || history[1].Op != OpUpdate {
+		t.Fatalf("expected rename and update records, got %+v", history)
+	}
+	if history, _ = s.History("old"); len(history) != 2 || history[0].Seq != 1 {
+		t.Fatalf("expected compacted records to be kept, got %+v", history)
+	}
+}
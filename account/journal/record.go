@@ -0,0 +1,213 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+)
+
+const (
+	OpUpdate = "update" // Account replaces any Account named Name
+	OpDelete = "delete" // The Account named Name is removed
+	OpRename = "rename" // The Account named Name is removed and Account replaces any Account named NewName
+)
+
+const (
+	journalPrefix = "journal-"
+	journalSuffix = ".jsonl"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Record is one change to the store, as written to the journal.
+type Record struct {
+	Seq     uint64           // Position in the journal, counting from 1
+	Time    time.Time        // When the change was made
+	Op      string           // One of the Op constants
+	Name    string           // The Account changed
+	NewName string           `json:",omitempty"` // The Account's new name, for OpRename
+	Account *account.Account `json:",omitempty"` // The Account after the change, for OpUpdate and OpRename
+}
+
+// line is a Record as a line of the journal. The checksum covers the exact
+// bytes of the encoded Record.
+type line struct {
+	CRC    uint32
+	Record json.RawMessage
+}
+
+func (r Record) encode() ([]byte, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	l, err := json.Marshal(line{CRC: crc32.Checksum(data, crcTable), Record: data})
+	if err != nil {
+		return nil, err
+	}
+	return append(l, '\n'), nil
+}
+
+func decode(data []byte) (Record, error) {
+	var l line
+	var r Record
+	if err := json.Unmarshal(data, &l); err != nil {
+		return r, err
+	}
+	if crc32.Checksum(l.Record, crcTable) != l.CRC {
+		return r, errors.New("checksum mismatch")
+	}
+	if err := json.Unmarshal(l.Record, &r); err != nil {
+		return r, err
+	}
+	switch r.Op {
+	case OpUpdate, OpRename:
+		if r.Account == nil {
+			return r, errors.New(r.Op + " record without account")
+		}
+	case OpDelete:
+	default:
+		return r, errors.New("unknown op " + strconv.Quote(r.Op))
+	}
+	return r, nil
+}
+
+// apply makes the change recorded by r to accounts.
+func (r Record) apply(accounts map[string]*account.Account) {
+	switch r.Op {
+	case OpUpdate:
+		accounts[r.Name] = r.Account
+	case OpDelete:
+		delete(accounts, r.Name)
+	case OpRename:
+		delete(accounts, r.Name)
+		accounts[r.NewName] = r.Account
+	}
+}
+
+func journalPath(dir string, start uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%020d%s", journalPrefix, start, journalSuffix))
+}
+
+// journals returns the first record numbers of the journal files in dir, in
+// order.
+func journals(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading journal directory")
+	}
+	var starts []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, journalPrefix) || !strings.HasSuffix(name, journalSuffix) {
+			continue
+		}
+		start, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, journalPrefix), journalSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return starts, nil
+}
+
+func openJournal(dir string, start uint64) (*os.File, error) {
+	fh, err := os.OpenFile(journalPath(dir, start), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	return fh, errors.Wrap(err, "opening journal")
+}
+
+// records calls f with each record in the journal file starting at start.
+// It returns the offset of the end of the last complete record, and whether
+// the file continues with an incomplete record. A record is incomplete only
+// if its newline is missing; a complete line that can't be decoded is an
+// error.
+func records(dir string, start uint64, f func(Record) error) (int64, bool, error) {
+	path := journalPath(dir, start)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "reading journal")
+	}
+	var offset int64
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			// A record is always written with its newline.
+			return offset, true, nil
+		}
+		r, err := decode(data[:end])
+		if err != nil {
+			return offset, false, errors.Wrapf(err, "corrupt journal %s at offset %d", path, offset)
+		}
+		if err := f(r); err != nil {
+			return offset, false, errors.Wrapf(err, "journal %s at offset %d", path, offset)
+		}
+		offset += int64(end + 1)
+		data = data[end+1:]
+	}
+	return offset, false, nil
+}
+
+// replay applies the records in the journal file starting at start that
+// aren't already in the snapshot. An incomplete record at the end of the
+// last journal file is removed.
+func (s *Store) replay(start uint64, last bool) error {
+	offset, torn, err := records(s.dir, start, func(r Record) error {
+		if r.Seq <= s.snapSeq {
+			return nil
+		}
+		if r.Seq != s.seq+1 {
+			return errors.New("expected record " + strconv.FormatUint(s.seq+1, 10) +
+				", got " + strconv.FormatUint(r.Seq, 10))
+		}
+		r.apply(s.accounts)
+		s.seq = r.Seq
+		return nil
+	})
+	if err != nil || !torn {
+		return err
+	}
+	path := journalPath(s.dir, start)
+	if !last {
+		return errors.New("corrupt journal " + path + " at offset " + strconv.FormatInt(offset, 10))
+	}
+	s.opts.Logger.Printf("warning: discarding incomplete record at offset %d of journal %s", offset, path)
+	return errors.Wrap(os.Truncate(path, offset), "truncating journal")
+}
+
+// History returns the records of changes to the named Account still in the
+// journal, oldest first, including renames to and from the name. Unless
+// Options.KeepJournal is set, only changes since the last compaction are
+// kept.
+func (s *Store) History(name string) ([]Record, error) {
+	s.compactLock.Lock()
+	defer s.compactLock.Unlock()
+	starts, err := journals(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var history []Record
+	for _, start := range starts {
+		_, _, err := records(s.dir, start, func(r Record) error {
+			if r.Name == name || r.NewName == name {
+				history = append(history, r)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return history, nil
+}
@@ -0,0 +1,199 @@
+package json
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+	"github.com/AgentZombie/dontusepasswords/account/internal/atomicfile"
+)
+
+const (
+	backupSuffix  = ".backup-"
+	corruptSuffix = ".corrupt-"
+	lockSuffix    = ".lock"
+	stampFormat   = "20060102T150405.000000000Z" // Sorts in time order
+)
+
+// file is the decoded contents of a store file.
+type file struct {
+	accounts map[string]*account.Account
+	sum      [sha256.Size]byte
+	modTime  time.Time
+	size     int64
+}
+
+// readFile reads and decodes a store file.
+func readFile(path string) (*file, error) {
+	infh, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading account store")
+	}
+	defer infh.Close()
+	fi, err := infh.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading account store")
+	}
+	data, err := io.ReadAll(infh)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading account store")
+	}
+	f := &file{
+		accounts: map[string]*account.Account{},
+		sum:      sha256.Sum256(data),
+		modTime:  fi.ModTime(),
+		size:     fi.Size(),
+	}
+	if err := json.Unmarshal(data, &f.accounts); err != nil {
+		return nil, corruptError{errors.Wrap(err, "decoding account store "+path)}
+	}
+	if f.accounts == nil {
+		f.accounts = map[string]*account.Account{}
+	}
+	return f, nil
+}
+
+// corruptError indicates a store file that was read but couldn't be
+// decoded, as opposed to one that couldn't be read at all.
+type corruptError struct {
+	error
+}
+
+func isCorrupt(err error) bool {
+	_, ok := err.(corruptError)
+	return ok
+}
+
+// same reports whether two versions of an Account are equal, either of
+// which may be nil if the Account doesn't exist.
+func same(a, b *account.Account) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	aj, aerr := json.Marshal(a)
+	bj, berr := json.Marshal(b)
+	return aerr == nil && berr == nil && bytes.Equal(aj, bj)
+}
+
+func copyAccounts(accounts map[string]*account.Account) map[string]*account.Account {
+	c := make(map[string]*account.Account, len(accounts))
+	for name, a := range accounts {
+		c[name] = a
+	}
+	return c
+}
+
+func isIn(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func stamp() string {
+	return time.Now().UTC().Format(stampFormat)
+}
+
+// backup keeps the current store file, if there is one, under a timestamped
+// name, unless the newest backup is more recent than Options.BackupInterval.
+// A hard link is used where possible to avoid copying.
+func (s *Store) backup() error {
+	if s.opts.BackupInterval > 0 {
+		names, err := s.backups()
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			t, err := time.Parse(stampFormat, strings.TrimPrefix(filepath.Base(names[0]), filepath.Base(s.path)+backupSuffix))
+			if err == nil && time.Since(t) < s.opts.BackupInterval {
+				return nil
+			}
+		}
+	}
+	name := s.path + backupSuffix + stamp()
+	err := os.Link(s.path, name)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(name, data)
+}
+
+// backups returns the paths of the store's backups, newest first.
+func (s *Store) backups() ([]string, error) {
+	dir, base := filepath.Split(s.path)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), base+backupSuffix) {
+			names = append(names, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+// prune removes the oldest backups beyond Options.Backups.
+func (s *Store) prune() error {
+	names, err := s.backups()
+	if err != nil {
+		return err
+	}
+	for len(names) > s.opts.Backups {
+		if err := os.Remove(names[len(names)-1]); err != nil {
+			return err
+		}
+		names = names[:len(names)-1]
+	}
+	return nil
+}
+
+// recover restores the newest backup that can be decoded after the store
+// file was found to be corrupt. The corrupt file is moved aside for
+// inspection. If no backup can be decoded, cause is returned.
+func (s *Store) recover(cause error) error {
+	names, err := s.backups()
+	if err != nil {
+		return errors.Wrapf(cause, "listing backups: %s", err)
+	}
+	for _, name := range names {
+		if _, err := readFile(name); err != nil {
+			s.opts.Logger.Printf("warning: skipping unreadable account store backup: %s", err)
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return errors.Wrap(err, "reading account store backup")
+		}
+		aside := s.path + corruptSuffix + stamp()
+		if err := os.Rename(s.path, aside); err != nil {
+			return errors.Wrap(err, "moving corrupt account store aside")
+		}
+		if err := atomicfile.Write(s.path, data); err != nil {
+			return errors.Wrap(err, "restoring account store backup")
+		}
+		s.opts.Logger.Printf("warning: %s; moved it to %s and restored backup %s", cause, aside, name)
+		return nil
+	}
+	return cause
+}
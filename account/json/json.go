@@ -1,66 +1,217 @@
-// package json provides Account storage in a simple, single JSON file. This
-// module does no versioning or backups and is not suitable for non-trivial
-// applications.
+// package json provides Account storage in a simple, single JSON file. The
+// file is replaced atomically on each Flush and previous versions can be
+// kept as backups, but every Flush rewrites all accounts, so this module is
+// not suitable for large numbers of accounts.
+//
+// Several processes can share a store file. Flush locks the file, reloads
+// it, and merges in changes made by other processes since it was last read;
+// see Flush for how conflicting changes to the same Account are handled.
 package json
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"log"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/AgentZombie/dontusepasswords/account"
+	"github.com/AgentZombie/dontusepasswords/account/internal/atomicfile"
 )
 
-// Store holds the Account objects and can write them to disk.
+// Options configure how a Store is opened and written.
+type Options struct {
+	Create         bool          // Create an empty store if the file doesn't exist
+	Backups        int           // Previous versions of the file kept by Flush
+	BackupInterval time.Duration // The least time between backups, if non-zero, so frequent Flushes don't replace them all at once
+	Overwrite      bool          // Keep local changes to Accounts also changed by another process, rather than rejecting them
+	Watch          time.Duration // How often to check the file for changes by other processes, if non-zero; see Reload
+	Logger         *log.Logger   // Receives warnings, e.g. recovery from a backup; nil uses the standard logger
+}
+
+// Conflict can be implemented by errors to indicate that Accounts changed
+// locally were also changed by another process.
+type Conflict interface {
+	IsConflict() bool
+}
+
+// IsConflict checks whether or not an error indicates conflicting changes
+// to Accounts.
+func IsConflict(err error) bool {
+	if c, ok := errors.Cause(err).(Conflict); ok {
+		return c.IsConflict()
+	}
+	return false
+}
+
+// ConflictError is returned by Flush when Accounts changed locally were also
+// changed by another process. Names lists the Accounts whose local changes
+// were discarded.
+type ConflictError struct {
+	Names []string
+}
+
+// Error returns the string representation of the error.
+func (c ConflictError) Error() string {
+	s := "accounts changed by another process:"
+	for _, name := range c.Names {
+		s += " " + name
+	}
+	return s
+}
+
+// IsConflict indicates that changes conflicted.
+func (c ConflictError) IsConflict() bool {
+	return true
+}
+
+// Store holds the Account objects and can write them to disk. A Store is
+// safe for concurrent use. Accounts are copied in and out of the Store, so
+// changes to an Account returned by Get aren't seen by the Store or other
+// callers until it's passed to Update, and the last Update wins. Use Modify
+// to change an Account without losing concurrent changes.
 type Store struct {
-	path      string
-	accounts  map[string]*account.Account
-	writeLock sync.Mutex
+	path string
+	opts Options
+
+	lock     sync.RWMutex // Guards the fields below
+	accounts map[string]*account.Account
+	disk     map[string]*account.Account // The file's Accounts when last read or written
+	sum      [sha256.Size]byte           // Hash of the file when last read or written
+	modTime  time.Time                   // Modification time of the file when last read or written
+	size     int64                       // Size of the file when last read or written
+	// dirty holds the Accounts changed since the last Flush, each with the
+	// version from disk that the change was based on, or nil if the Account
+	// didn't exist on disk.
+	dirty map[string]*account.Account
+
+	writeLock sync.Mutex // Serializes reads and writes of path
+	done      chan struct{}
+	closeOnce sync.Once
+	watcher   sync.WaitGroup
 }
 
 // New creates a new Store object with the given file path. The create
 // argument specifies whether or not a new store file should be created if it
-// doesn't already exist.
+// doesn't already exist. No backups are kept; use Open for more options.
 func New(path string, create bool) (*Store, error) {
-	accounts := map[string]*account.Account{}
-	infh, err := os.Open(path)
+	return Open(path, Options{Create: create})
+}
+
+// Open creates a new Store object with the given file path and Options. If
+// the file can't be decoded, the newest backup that can is restored in its
+// place, a warning is logged, and the corrupt file is moved aside. If
+// Options.Watch is set, Close must be called when the Store is no longer
+// needed.
+func Open(path string, o Options) (*Store, error) {
+	if o.Backups < 0 || o.Watch < 0 {
+		return nil, errors.New("negative account store option")
+	}
+	if o.Logger == nil {
+		o.Logger = log.Default()
+	}
+	s := &Store{
+		path:     path,
+		opts:     o,
+		accounts: map[string]*account.Account{},
+		disk:     map[string]*account.Account{},
+		dirty:    map[string]*account.Account{},
+		done:     make(chan struct{}),
+	}
+	unlock, err := lockFile(path, true)
 	if err != nil {
-		if os.IsNotExist(err) && create {
-			return &Store{
-				path:     path,
-				accounts: accounts,
-			}, nil
-		} else {
-			return nil, errors.Wrap(err, "reading account store")
+		return nil, errors.Wrap(err, "locking account store")
+	}
+	defer unlock()
+	f, err := readFile(path)
+	if isCorrupt(err) {
+		if err = s.recover(err); err == nil {
+			f, err = readFile(path)
 		}
 	}
-	if err := json.NewDecoder(infh).Decode(&accounts); err != nil {
-		return nil, errors.Wrap(err, "decoding account store")
+	if err != nil && !(os.IsNotExist(errors.Cause(err)) && o.Create) {
+		return nil, err
 	}
-	return &Store{
-		path:     path,
-		accounts: accounts,
-	}, nil
+	if f != nil {
+		s.accounts, s.disk = f.accounts, copyAccounts(f.accounts)
+		s.sum, s.modTime, s.size = f.sum, f.modTime, f.size
+	}
+	if o.Watch > 0 {
+		s.watcher.Add(1)
+		go s.watch()
+	}
+	return s, nil
 }
 
-// Get retrieves an Account object by name.
+// Close stops watching the file for changes. It doesn't Flush.
+func (s *Store) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	s.watcher.Wait()
+	return nil
+}
+
+// Get retrieves a copy of an Account object by name.
 func (s *Store) Get(name string) (*account.Account, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	if a, ok := s.accounts[name]; ok {
-		return a, nil
+		return a.Clone(), nil
 	}
-	return nil, &account.NotFoundError{"not found"}
+	return nil, &account.NotFoundError{Str: "not found"}
 }
 
-// Update updates the internal representation of an Account.
+// Names returns the names of all Accounts in the store, sorted.
+func (s *Store) Names() ([]string, error) {
+	s.lock.RLock()
+	names := make([]string, 0, len(s.accounts))
+	for name := range s.accounts {
+		names = append(names, name)
+	}
+	s.lock.RUnlock()
+	sort.Strings(names)
+	return names, nil
+}
+
+// Update updates the internal representation of an Account with a copy of
+// a.
 func (s *Store) Update(a *account.Account) error {
-	s.accounts[a.Name] = a
+	c := a.Clone()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.markDirty(c.Name)
+	s.accounts[c.Name] = c
 	return nil
 }
 
+// Modify calls f with a copy of the named Account while the Store is locked
+// and, if f returns true, stores the changed copy. f must be quick and must
+// not change the Account's Name or use the Store. The changed copy is
+// returned.
+func (s *Store) Modify(name string, f func(a *account.Account) bool) (*account.Account, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	a, ok := s.accounts[name]
+	if !ok {
+		return nil, &account.NotFoundError{Str: "not found"}
+	}
+	c := a.Clone()
+	if f(c) {
+		s.markDirty(name)
+		s.accounts[name] = c.Clone()
+	}
+	return c, nil
+}
+
 // Delete removes an Account from the store if it exists in the store.
 func (s *Store) Delete(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.markDirty(name)
 	delete(s.accounts, name)
 	return nil
 }
@@ -69,25 +220,192 @@ func (s *Store) Delete(name string) error {
 // Account if one already exists with the new name. The Account object
 // is modified to receive the new name.
 func (s *Store) Rename(newname string, a *account.Account) error {
-	old := a.Name
-	s.accounts[newname] = a
-	s.Delete(old)
+	c := a.Clone()
+	c.Name = newname
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if a.Name != newname {
+		s.markDirty(a.Name)
+		delete(s.accounts, a.Name)
+	}
+	s.markDirty(newname)
+	s.accounts[newname] = c
 	a.Name = newname
 	return nil
 }
 
-// Flush writes all store data out to disk, overwriting existing data.
-// Concurrent calls to Flush() are thread-safe but inefficient.
+// markDirty records a local change to the named Account. The lock must be
+// held.
+func (s *Store) markDirty(name string) {
+	if _, ok := s.dirty[name]; !ok {
+		s.dirty[name] = s.disk[name]
+	}
+}
+
+// Flush writes all store data out to disk. The file is locked against other
+// processes and reread first, and changes other processes have made to
+// Accounts that weren't changed locally are kept. If an Account was changed
+// both locally and by another process, the other process's change is kept
+// and an error satisfying IsConflict is returned after writing, unless
+// Options.Overwrite is set.
+//
+// The data is written to a temporary file which then replaces the existing
+// file, so a failed Flush leaves the previous version intact. If
+// Options.Backups is set, the previous version is kept as a timestamped
+// backup and the oldest backups beyond that number are removed. Concurrent
+// calls to Flush() are thread-safe but inefficient.
 func (s *Store) Flush() error {
 	s.writeLock.Lock()
 	defer s.writeLock.Unlock()
-	outfh, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	unlock, err := lockFile(s.path, true)
+	if err != nil {
+		return errors.Wrap(err, "locking account store")
+	}
+	defer unlock()
+	f, err := readFile(s.path)
+	if os.IsNotExist(errors.Cause(err)) {
+		err = nil
+	}
 	if err != nil {
-		return errors.Wrap(err, "writing account store")
+		return err
+	}
+
+	s.lock.Lock()
+	disk := s.disk
+	if f != nil {
+		disk = f.accounts
 	}
-	defer outfh.Close()
-	if err := json.NewEncoder(outfh).Encode(&s.accounts); err != nil {
+	merged, conflicts := s.merge(disk, true)
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(&merged); err != nil {
+		s.lock.Unlock()
 		return errors.Wrap(err, "encoding account store")
 	}
+	applied := make([]string, 0, len(s.dirty))
+	for name := range s.dirty {
+		if s.opts.Overwrite || !isIn(conflicts, name) {
+			applied = append(applied, name)
+		}
+	}
+	// Changes made while the file is written are based on what's written.
+	s.accounts, s.disk, s.dirty = merged, copyAccounts(merged), map[string]*account.Account{}
+	s.lock.Unlock()
+
+	if s.opts.Backups > 0 {
+		err = errors.Wrap(s.backup(), "backing up account store")
+	}
+	if err == nil {
+		err = errors.Wrap(atomicfile.Write(s.path, buf.Bytes()), "writing account store")
+	}
+	var fi os.FileInfo
+	if err == nil {
+		fi, err = os.Stat(s.path)
+	}
+
+	s.lock.Lock()
+	if err != nil {
+		// Nothing was written, so keep the local changes for the next
+		// Flush, based on what's actually on disk.
+		s.disk = disk
+		for _, name := range applied {
+			s.dirty[name] = nil
+		}
+		for name := range s.dirty {
+			s.dirty[name] = disk[name]
+		}
+		s.lock.Unlock()
+		return err
+	}
+	s.sum, s.modTime, s.size = sha256.Sum256(buf.Bytes()), fi.ModTime(), fi.Size()
+	s.lock.Unlock()
+
+	if s.opts.Backups > 0 {
+		if err := s.prune(); err != nil {
+			return errors.Wrap(err, "removing old account store backups")
+		}
+	}
+	if len(conflicts) > 0 && !s.opts.Overwrite {
+		return ConflictError{Names: conflicts}
+	}
+	return nil
+}
+
+// Reload rereads the file, making changes other processes have made to
+// Accounts visible. Local changes that haven't been flushed are kept, and
+// any conflicts with them are reported by the next Flush. Reload is called
+// whenever the file changes if Options.Watch is set.
+func (s *Store) Reload() error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	unlock, err := lockFile(s.path, false)
+	if err != nil {
+		return errors.Wrap(err, "locking account store")
+	}
+	defer unlock()
+	f, err := readFile(s.path)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if f.sum != s.sum {
+		s.accounts, _ = s.merge(f.accounts, false)
+		s.disk = f.accounts
+	}
+	s.sum, s.modTime, s.size = f.sum, f.modTime, f.size
 	return nil
 }
+
+// merge applies the local changes to the Accounts from disk, returning the
+// result and the names of Accounts that were changed differently on disk.
+// If resolve is set, conflicts are settled as Options.Overwrite says;
+// otherwise local changes are kept so that Flush can settle them later. The
+// lock must be held.
+func (s *Store) merge(disk map[string]*account.Account, resolve bool) (map[string]*account.Account, []string) {
+	merged := copyAccounts(disk)
+	var conflicts []string
+	for name, base := range s.dirty {
+		local := s.accounts[name]
+		if !same(disk[name], base) && !same(disk[name], local) {
+			conflicts = append(conflicts, name)
+			if resolve && !s.opts.Overwrite {
+				continue
+			}
+		}
+		if local != nil {
+			merged[name] = local
+		} else {
+			delete(merged, name)
+		}
+	}
+	sort.Strings(conflicts)
+	return merged, conflicts
+}
+
+// watch calls Reload whenever the file's modification time or size changes
+// until the Store is closed.
+func (s *Store) watch() {
+	defer s.watcher.Done()
+	t := time.NewTicker(s.opts.Watch)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+		fi, err := os.Stat(s.path)
+		if err != nil {
+			continue
+		}
+		s.lock.RLock()
+		changed := !fi.ModTime().Equal(s.modTime) || fi.Size() != s.size
+		s.lock.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := s.Reload(); err != nil {
+			s.opts.Logger.Printf("warning: reloading account store: %s", err)
+		}
+	}
+}
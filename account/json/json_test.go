@@ -0,0 +1,341 @@
+package json
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+	"github.com/AgentZombie/dontusepasswords/account/storetest"
+)
+
+var factory = storetest.Factory{
+	New: func(t *testing.T) account.Store {
+		s, err := New(filepath.Join(t.TempDir(), "accounts.json"), true)
+		if err != nil {
+			t.Fatalf("unexpected error creating store: %q", err)
+		}
+		return s
+	},
+	Reopen: func(t *testing.T, s account.Store) account.Store {
+		r, err := New(s.(*Store).path, false)
+		if err != nil {
+			t.Fatalf("unexpected error reopening store: %q", err)
+		}
+		return r
+	},
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, factory)
+}
+
+func TestConcurrent(t *testing.T) {
+	storetest.RunConcurrent(t, factory)
+}
+
+func TestCopies(t *testing.T) {
+	s := factory.New(t)
+	a := &account.Account{Name: "user", AuthData: []byte("challenge")}
+	s.Update(a)
+	a.AuthData[0] = 'X'
+	got, _ := s.Get("user")
+	if string(got.AuthData) != "challenge" {
+		t.Fatal("expected store to keep a copy of updated account")
+	}
+	got.AuthData[0] = 'X'
+	got.Failures++
+	if again, _ := s.Get("user"); string(again.AuthData) != "challenge" || again.Failures != 0 {
+		t.Fatal("expected changes to returned account not to be stored without Update")
+	}
+}
+
+func TestBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	s, err := Open(path, Options{Create: true, Backups: 2})
+	if err != nil {
+		t.Fatalf("unexpected error creating store: %q", err)
+	}
+	for i := 0; i < 5; i++ {
+		s.Update(&account.Account{Name: "user", Failures: i})
+		if err := s.Flush(); err != nil {
+			t.Fatalf("unexpected error flushing: %q", err)
+		}
+	}
+	names, err := s.backups()
+	if err != nil {
+		t.Fatalf("unexpected error listing backups: %q", err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected 2 backups, got %d", len(names))
+	}
+	for i, name := range names {
+		f, err := readFile(name)
+		if err != nil {
+			t.Fatalf("unexpected error loading backup: %q", err)
+		}
+		if f.accounts["user"].Failures != 3-i {
+			t.Fatalf("expected backup %d to hold failures %d, got %d", i, 3-i, f.accounts["user"].Failures)
+		}
+	}
+	if matches, _ := filepath.Glob(path + ".tmp-*"); len(matches) != 0 {
+		t.Fatalf("expected no temporary files left, got %v", matches)
+	}
+}
+
+func TestBackupInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	s, err := Open(path, Options{Create: true, Backups: 2, BackupInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error creating store: %q", err)
+	}
+	for i := 0; i < 5; i++ {
+		s.Update(&account.Account{Name: "user", Failures: i})
+		if err := s.Flush(); err != nil {
+			t.Fatalf("unexpected error flushing: %q", err)
+		}
+	}
+	names, err := s.backups()
+	if err != nil {
+		t.Fatalf("unexpected error listing backups: %q", err)
+	}
+	if len(names) != 1 {
+		t.Fatalf("expected 1 backup within the interval, got %d", len(names))
+	}
+	f, err := readFile(names[0])
+	if err != nil {
+		t.Fatalf("unexpected error loading backup: %q", err)
+	}
+	if f.accounts["user"].Failures != 0 {
+		t.Fatalf("expected backup to hold the first version, got failures %d", f.accounts["user"].Failures)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	s, err := Open(path, Options{Create: true, Backups: 1})
+	if err != nil {
+		t.Fatalf("unexpected error creating store: %q", err)
+	}
+	for _, name := range []string{"old", "new"} {
+		s.Update(&account.Account{Name: name})
+		s.Flush()
+	}
+	if err := os.WriteFile(path, []byte(`{"new": {"Na`), 0600); err != nil {
+		t.Fatalf("unexpected error corrupting store: %q", err)
+	}
+
+	buf := &bytes.Buffer{}
+	r, err := Open(path, Options{Logger: log.New(buf, "", 0)})
+	if err != nil {
+		t.Fatalf("unexpected error opening corrupt store: %q", err)
+	}
+	if _, err := r.Get("old"); err != nil {
+		t.Fatalf("expected account from backup, got %q", err)
+	}
+	if _, err := r.Get("new"); !account.IsNotFound(err) {
+		t.Fatalf("expected account missing from backup to be not found, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "restored backup") {
+		t.Fatalf("expected warning about loading backup, got %q", buf.String())
+	}
+	if matches, _ := filepath.Glob(path + ".corrupt-*"); len(matches) != 1 {
+		t.Fatalf("expected corrupt file to be moved aside, got %v", matches)
+	}
+}
+
+func TestCorruptWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatalf("unexpected error writing store: %q", err)
+	}
+	if _, err := Open(path, Options{Create: true}); err == nil {
+		t.Fatal("expected error opening corrupt store without backups")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected corrupt store to be left in place, got %q", err)
+	}
+}
+
+// open opens a second Store on the same file, as another process would.
+func open(t *testing.T, path string, o Options) *Store {
+	s, err := Open(path, o)
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %q", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	a := open(t, path, Options{Create: true})
+	a.Update(&account.Account{Name: "deleted"})
+	a.Update(&account.Account{Name: "renamed"})
+	if err := a.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %q", err)
+	}
+	b := open(t, path, Options{})
+
+	a.Update(&account.Account{Name: "a"})
+	a.Delete("deleted")
+	if err := a.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %q", err)
+	}
+	b.Update(&account.Account{Name: "b"})
+	r, _ := b.Get("renamed")
+	b.Rename("moved", r)
+	if err := b.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %q", err)
+	}
+
+	for _, s := range []*Store{b, open(t, path, Options{})} {
+		names, _ := s.Names()
+		if strings.Join(names, ",") != "a,b,moved" {
+			t.Fatalf("expected changes from both stores, got %v", names)
+		}
+	}
+}
+
+func TestConflict(t *testing.T) {
+	for _, overwrite := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "accounts.json")
+		a := open(t, path, Options{Create: true})
+		a.Update(&account.Account{Name: "shared"})
+		a.Flush()
+		b := open(t, path, Options{Overwrite: overwrite})
+
+		a.Update(&account.Account{Name: "shared", Failures: 1})
+		a.Flush()
+		b.Update(&account.Account{Name: "shared", Failures: 2})
+		b.Update(&account.Account{Name: "other"})
+		err := b.Flush()
+		if overwrite && err != nil {
+			t.Fatalf("unexpected error flushing: %q", err)
+		}
+		if !overwrite && !IsConflict(err) {
+			t.Fatalf("expected conflict error, got %v", err)
+		}
+		want := 1
+		if overwrite {
+			want = 2
+		}
+		for _, s := range []*Store{b, open(t, path, Options{})} {
+			if got, _ := s.Get("shared"); got.Failures != want {
+				t.Fatalf("expected failures %d with overwrite %v, got %d", want, overwrite, got.Failures)
+			}
+			if _, err := s.Get("other"); err != nil {
+				t.Fatalf("expected non-conflicting change to be kept, got %q", err)
+			}
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	a := open(t, path, Options{Create: true})
+	a.Update(&account.Account{Name: "shared"})
+	a.Flush()
+	b := open(t, path, Options{})
+	b.Update(&account.Account{Name: "shared", Failures: 2})
+
+	a.Update(&account.Account{Name: "shared", Failures: 1})
+	a.Update(&account.Account{Name: "new"})
+	a.Flush()
+	if err := b.Reload(); err != nil {
+		t.Fatalf("unexpected error reloading: %q", err)
+	}
+	if _, err := b.Get("new"); err != nil {
+		t.Fatalf("expected reloaded account, got %q", err)
+	}
+	if got, _ := b.Get("shared"); got.Failures != 2 {
+		t.Fatalf("expected unflushed change to be kept, got failures %d", got.Failures)
+	}
+	if err := b.Flush(); !IsConflict(err) {
+		t.Fatalf("expected conflict error after reload, got %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	a := open(t, path, Options{Create: true})
+	a.Flush()
+	b := open(t, path, Options{Watch: 10 * time.Millisecond})
+
+	a.Update(&account.Account{Name: "new"})
+	a.Flush()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := b.Get("new"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected watched store to reload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %q", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	s := open(t, path, Options{Create: true})
+	unlock, err := lockFile(path, true)
+	if err != nil {
+		t.Fatalf("unexpected error locking: %q", err)
+	}
+	flushed := make(chan error)
+	go func() { flushed <- s.Flush() }()
+	select {
+	case <-flushed:
+		if runtime.GOOS == "linux" {
+			t.Fatal("expected Flush to wait for lock")
+		}
+	case <-time.After(50 * time.Millisecond):
+		unlock()
+		if err := <-flushed; err != nil {
+			t.Fatalf("unexpected error flushing: %q", err)
+		}
+	}
+}
+
+func TestModify(t *testing.T) {
+	s := factory.New(t).(*Store)
+	s.Update(&account.Account{Name: "user"})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Modify("user", func(a *account.Account) bool {
+				a.Failures++
+				return true
+			})
+		}()
+	}
+	wg.Wait()
+	if a, _ := s.Get("user"); a.Failures != 20 {
+		t.Fatalf("expected 20 failures, got %d", a.Failures)
+	}
+	a, err := s.Modify("user", func(a *account.Account) bool {
+		a.Failures = 0
+		return false
+	})
+	if err != nil || a.Failures != 0 {
+		t.Fatalf("expected modified copy, got %+v, %v", a, err)
+	}
+	if a, _ := s.Get("user"); a.Failures != 20 {
+		t.Fatal("expected unstored modification to be discarded")
+	}
+	if _, err := s.Modify("nosuchuser", func(*account.Account) bool { return true }); !account.IsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package json
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an advisory lock shared by all processes using the store
+// at path, waiting until it's available. A separate lock file is used
+// because Flush replaces the store file. The returned function releases the
+// lock.
+func lockFile(path string, exclusive bool) (func() error, error) {
+	fh, err := os.OpenFile(path+lockSuffix, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err = syscall.Flock(int(fh.Fd()), how)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+	// Closing the file releases the lock.
+	return fh.Close, nil
+}
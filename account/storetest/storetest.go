@@ -0,0 +1,294 @@
+// package storetest provides a conformance suite for account.Store
+// implementations, checking the semantics Accounts relies on:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, storetest.Factory{New: newStore, Reopen: reopenStore})
+//	}
+//
+// RunConcurrent checks that a store is safe for concurrent use, and is only
+// meaningful under the race detector:
+//
+//	go test -race
+package storetest
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+)
+
+// Factory creates stores for the suite.
+type Factory struct {
+	New    func(t *testing.T) account.Store                  // Create a new, empty store
+	Reopen func(t *testing.T, s account.Store) account.Store // Open the storage s flushed to, or nil if stores don't persist
+}
+
+// Run checks that stores made by f look up, update, delete, rename, list,
+// and flush Accounts as Accounts expects.
+func Run(t *testing.T, f Factory) {
+	t.Helper()
+	t.Run("NotFound", func(t *testing.T) { notFound(t, f) })
+	t.Run("UpdateGet", func(t *testing.T) { updateGet(t, f) })
+	t.Run("Replace", func(t *testing.T) { replace(t, f) })
+	t.Run("Delete", func(t *testing.T) { del(t, f) })
+	t.Run("Rename", func(t *testing.T) { rename(t, f) })
+	t.Run("RenameOverwrite", func(t *testing.T) { renameOverwrite(t, f) })
+	t.Run("Lister", func(t *testing.T) { lister(t, f) })
+	if f.Reopen != nil {
+		t.Run("Flush", func(t *testing.T) { flush(t, f) })
+	}
+}
+
+// testAccount returns an Account with every field set.
+func testAccount(name string) *account.Account {
+	now := time.Now().Truncate(time.Second)
+	return &account.Account{
+		Name:        name,
+		AuthType:    "TESTTYPE",
+		AuthData:    []byte("challenge " + name),
+		Locked:      false,
+		Expires:     now.Add(time.Hour),
+		AuxData:     []byte("aux " + name),
+		Failures:    2,
+		LastFailure: now.Add(-time.Minute),
+		Lockouts:    1,
+		LockedUntil: now.Add(time.Minute),
+		History:     []account.Challenge{{AuthType: "OLDTYPE", AuthData: []byte("old " + name)}},
+	}
+}
+
+// equal compares Accounts, allowing times to lose their monotonic clock
+// readings and locations in storage.
+func equal(a, b *account.Account) bool {
+	if a.Name != b.Name || a.AuthType != b.AuthType || !bytes.Equal(a.AuthData, b.AuthData) ||
+		a.Locked != b.Locked || !a.Expires.Equal(b.Expires) || !bytes.Equal(a.AuxData, b.AuxData) ||
+		a.Failures != b.Failures || !a.LastFailure.Equal(b.LastFailure) || a.Lockouts != b.Lockouts ||
+		!a.LockedUntil.Equal(b.LockedUntil) || len(a.History) != len(b.History) {
+		return false
+	}
+	for i := range a.History {
+		if a.History[i].AuthType != b.History[i].AuthType || !bytes.Equal(a.History[i].AuthData, b.History[i].AuthData) {
+			return false
+		}
+	}
+	return true
+}
+
+func update(t *testing.T, s account.Store, a *account.Account) {
+	t.Helper()
+	if err := s.Update(a); err != nil {
+		t.Fatalf("unexpected error updating %s: %q", a.Name, err)
+	}
+}
+
+func expectAccount(t *testing.T, s account.Store, want *account.Account) {
+	t.Helper()
+	got, err := s.Get(want.Name)
+	if err != nil {
+		t.Fatalf("unexpected error getting %s: %q", want.Name, err)
+	}
+	if !equal(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func expectNotFound(t *testing.T, s account.Store, name string) {
+	t.Helper()
+	a, err := s.Get(name)
+	if !account.IsNotFound(err) {
+		t.Fatalf("expected not found error getting %s, got %v", name, err)
+	}
+	if a != nil {
+		t.Fatalf("expected no account getting %s, got %+v", name, a)
+	}
+}
+
+func notFound(t *testing.T, f Factory) {
+	expectNotFound(t, f.New(t), "nobody")
+}
+
+func updateGet(t *testing.T, f Factory) {
+	s := f.New(t)
+	a := testAccount("user")
+	update(t, s, a)
+	expectAccount(t, s, testAccount("user"))
+}
+
+func replace(t *testing.T, f Factory) {
+	s := f.New(t)
+	update(t, s, testAccount("user"))
+	a := testAccount("user")
+	a.AuthData = []byte("new challenge")
+	a.Failures = 0
+	update(t, s, a)
+	expectAccount(t, s, a)
+}
+
+func del(t *testing.T, f Factory) {
+	s := f.New(t)
+	update(t, s, testAccount("user"))
+	update(t, s, testAccount("other"))
+	if err := s.Delete("user"); err != nil {
+		t.Fatalf("unexpected error deleting: %q", err)
+	}
+	expectNotFound(t, s, "user")
+	expectAccount(t, s, testAccount("other"))
+	if err := s.Delete("nobody"); err != nil {
+		t.Fatalf("unexpected error deleting missing account: %q", err)
+	}
+}
+
+func rename(t *testing.T, f Factory) {
+	s := f.New(t)
+	a := testAccount("old")
+	update(t, s, a)
+	if err := s.Rename("new", a); err != nil {
+		t.Fatalf("unexpected error renaming: %q", err)
+	}
+	if a.Name != "new" {
+		t.Fatalf("expected Rename to update the account name, got %s", a.Name)
+	}
+	expectNotFound(t, s, "old")
+	want := testAccount("old")
+	want.Name = "new"
+	expectAccount(t, s, want)
+}
+
+func renameOverwrite(t *testing.T, f Factory) {
+	s := f.New(t)
+	a := testAccount("old")
+	update(t, s, a)
+	update(t, s, testAccount("new"))
+	if err := s.Rename("new", a); err != nil {
+		t.Fatalf("unexpected error renaming over existing account: %q", err)
+	}
+	expectNotFound(t, s, "old")
+	want := testAccount("old")
+	want.Name = "new"
+	expectAccount(t, s, want)
+}
+
+func lister(t *testing.T, f Factory) {
+	s := f.New(t)
+	l, ok := s.(account.Lister)
+	if !ok {
+		t.Skip("not a Lister")
+	}
+	for _, name := range []string{"b", "a", "c"} {
+		update(t, s, testAccount(name))
+	}
+	s.Delete("c")
+	names, err := l.Names()
+	if err != nil {
+		t.Fatalf("unexpected error listing: %q", err)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatalf("expected names [a b], got %v", names)
+	}
+}
+
+func flush(t *testing.T, f Factory) {
+	s := f.New(t)
+	for _, name := range []string{"kept", "deleted", "renamed"} {
+		update(t, s, testAccount(name))
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %q", err)
+	}
+	expectAccount(t, f.Reopen(t, s), testAccount("kept"))
+
+	s.Delete("deleted")
+	a, _ := s.Get("renamed")
+	if err := s.Rename("moved", a); err != nil {
+		t.Fatalf("unexpected error renaming: %q", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %q", err)
+	}
+	r := f.Reopen(t, s)
+	expectAccount(t, r, testAccount("kept"))
+	expectNotFound(t, r, "deleted")
+	expectNotFound(t, r, "renamed")
+	want := testAccount("renamed")
+	want.Name = "moved"
+	expectAccount(t, r, want)
+}
+
+// RunConcurrent checks that stores made by f can be used from many
+// goroutines at once, including modifying returned Accounts and updating
+// them, as Accounts does, while other goroutines flush.
+func RunConcurrent(t *testing.T, f Factory) {
+	t.Helper()
+	const workers, rounds = 8, 50
+	s := f.New(t)
+	for i := 0; i < workers; i++ {
+		update(t, s, testAccount("user"+strconv.Itoa(i)))
+	}
+	update(t, s, testAccount("shared"))
+
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		errs []error
+	)
+	check := func(err error) {
+		if err != nil {
+			lock.Lock()
+			errs = append(errs, err)
+			lock.Unlock()
+		}
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			own := "user" + strconv.Itoa(i)
+			for r := 0; r < rounds; r++ {
+				for _, name := range []string{own, "shared"} {
+					a, err := s.Get(name)
+					if err != nil {
+						check(err)
+						continue
+					}
+					a.Failures++
+					a.History = append(a.History, account.Challenge{AuthType: "TESTTYPE", AuthData: []byte{byte(r)}})
+					check(s.Update(a))
+				}
+				tmp := own + "-tmp"
+				a, err := s.Get(own)
+				if err != nil {
+					check(err)
+					continue
+				}
+				check(s.Rename(tmp, a))
+				check(s.Rename(own, a))
+				if l, ok := s.(account.Lister); ok {
+					_, err := l.Names()
+					check(err)
+				}
+				if r%10 == 0 {
+					check(s.Flush())
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		t.Fatalf("unexpected error: %q", err)
+	}
+	for i := 0; i < workers; i++ {
+		a, err := s.Get("user" + strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("unexpected error getting account: %q", err)
+		}
+		if a.Failures != 2+rounds {
+			t.Fatalf("expected %d failures after updates, got %d", 2+rounds, a.Failures)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// package argon2 implements the Argon2id algorithm as an authentication
+// method. Normally this package is imported only for side-effects:
+//
+//	import _ "dontusepasswords/auth/argon2"
+//
+// Additional profiles can be registered under application-chosen names:
+//
+//	auth.Register("ARGON2IDHEAVY", argon2.New(argon2.Params{Time: 3, Memory: 256 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}))
+package argon2
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"math"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+
+	"github.com/AgentZombie/dontusepasswords/auth"
+	"github.com/AgentZombie/dontusepasswords/auth/phc"
+)
+
+const (
+	Argon2idDefault = "ARGON2IDDEFAULT" // Default-strength Argon2id
+
+	phcID = "argon2id"
+)
+
+var (
+	// DefaultParams are the parameters of the Argon2idDefault profile.
+	DefaultParams = Params{
+		Time:    1,
+		Memory:  64 * 1024,
+		Threads: 4,
+		KeyLen:  32,
+		SaltLen: 16,
+	}
+
+	// MinParams are the weakest parameters accepted at registration.
+	MinParams = Params{
+		Time:    1,
+		Memory:  19 * 1024,
+		Threads: 1,
+		KeyLen:  16,
+		SaltLen: 16,
+	}
+)
+
+// MaxMemory is the most memory, in bytes, that verifying a stored challenge
+// may use. Challenges requiring more are treated as corrupt rather than
+// risking exhausting memory.
+var MaxMemory uint64 = 1 << 30
+
+func init() {
+	auth.Register(Argon2idDefault, New(DefaultParams))
+}
+
+// Params holds the Argon2id cost parameters and output sizes.
+type Params struct {
+	Time    uint32 // Number of passes over memory
+	Memory  uint32 // Memory size in KiB
+	Threads uint8  // Degree of parallelism
+	KeyLen  uint32 // Length of the derived key in bytes
+	SaltLen uint32 // Length of the random salt in bytes
+}
+
+// Argon2id computes challenges as PHC strings of the form
+// $argon2id$v=19$m=<Memory>,t=<Time>,p=<Threads>$<salt>$<key>.
+// Verification uses the parameters stored in the challenge.
+type Argon2id struct {
+	params Params
+}
+
+// New creates an Argon2id with the given parameters. The parameters are
+// validated when the Argon2id is registered with auth.Register.
+func New(p Params) *Argon2id {
+	return &Argon2id{params: p}
+}
+
+// Params returns the parameters used to compute new challenges.
+func (a Argon2id) Params() Params {
+	return a.params
+}
+
+func (a Argon2id) Compute(v []byte) ([]byte, error) {
+	p := a.params
+	salt := make([]byte, p.SaltLen)
+	n, err := rand.Read(salt)
+	if n != int(p.SaltLen) {
+		return nil, errors.New("wrong number of salt bytes read")
+	}
+	if err != nil {
+		return nil, err
+	}
+	k := argon2.IDKey(v, salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	h := &phc.Hash{
+		ID:      phcID,
+		Version: argon2.Version,
+		Params: []phc.Param{
+			phc.IntParam("m", int(p.Memory)),
+			phc.IntParam("t", int(p.Time)),
+			phc.IntParam("p", int(p.Threads)),
+		},
+		Salt: salt,
+		Hash: k,
+	}
+	return h.Bytes(), nil
+}
+
+func (a Argon2id) Verify(challenge, attempt []byte) (bool, error) {
+	p, salt, key, err := decode(challenge)
+	if err != nil {
+		return false, &auth.CorruptError{Str: err.Error()}
+	}
+	k := argon2.IDKey(attempt, salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return subtle.ConstantTimeCompare(k, key) == 1, nil
+}
+
+// NeedsRehash reports whether the challenge was computed with weaker
+// parameters than a.
+func (a Argon2id) NeedsRehash(challenge []byte) bool {
+	p, _, _, err := decode(challenge)
+	if err != nil {
+		return true
+	}
+	return p.weakerThan(a.params)
+}
+
+// MemoryCost returns the memory used to compute a challenge, in bytes.
+func (a Argon2id) MemoryCost() uint64 {
+	return uint64(a.params.Memory) * 1024
+}
+
+// Validate rejects parameters weaker than MinParams.
+func (a Argon2id) Validate() error {
+	p := a.params
+	if p.weakerThan(MinParams) {
+		return errors.New("argon2id parameters weaker than minimum")
+	}
+	if p.Memory < 8*uint32(p.Threads) {
+		return errors.New("argon2id memory must be at least 8KiB per thread")
+	}
+	return nil
+}
+
+func (p Params) weakerThan(o Params) bool {
+	return p.Memory < o.Memory || p.Time < o.Time || p.Threads < o.Threads ||
+		p.KeyLen < o.KeyLen || p.SaltLen < o.SaltLen
+}
+
+// decode extracts the parameters, salt, and key from a stored challenge.
+func decode(challenge []byte) (Params, []byte, []byte, error) {
+	h, err := phc.Parse(challenge)
+	if err != nil {
+		return Params{}, nil, nil, err
+	}
+	if h.ID != phcID {
+		return Params{}, nil, nil, errors.New("not an argon2id challenge")
+	}
+	if h.Version != argon2.Version {
+		return Params{}, nil, nil, errors.New("unsupported argon2 version")
+	}
+	if len(h.Salt) == 0 || len(h.Hash) == 0 {
+		return Params{}, nil, nil, errors.New("argon2id challenge missing salt or key")
+	}
+	if len(h.Hash) < int(MinParams.KeyLen) {
+		return Params{}, nil, nil, errors.New("argon2id key shorter than minimum")
+	}
+	m, err := h.Int("m")
+	if err != nil {
+		return Params{}, nil, nil, err
+	}
+	t, err := h.Int("t")
+	if err != nil {
+		return Params{}, nil, nil, err
+	}
+	p, err := h.Int("p")
+	if err != nil {
+		return Params{}, nil, nil, err
+	}
+	if m < 8 || int64(m) > math.MaxUint32 || t < 1 || int64(t) > math.MaxUint32 || p < 1 || p > math.MaxUint8 ||
+		m < 8*p || uint64(m)*1024 > MaxMemory {
+		return Params{}, nil, nil, errors.New("argon2id parameters out of range")
+	}
+	return Params{
+		Time:    uint32(t),
+		Memory:  uint32(m),
+		Threads: uint8(p),
+		KeyLen:  uint32(len(h.Hash)),
+		SaltLen: uint32(len(h.Salt)),
+	}, h.Salt, h.Hash, nil
+}
@@ -0,0 +1,19 @@
+package argon2
+
+import (
+	"testing"
+
+	"github.com/AgentZombie/dontusepasswords/auth/authtest"
+)
+
+// From the Argon2 reference implementation's command line tool.
+var vectors = []authtest.Vector{
+	{
+		Challenge: []byte("$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"),
+		Value:     []byte("password"),
+	},
+}
+
+func TestConformance(t *testing.T) {
+	authtest.Run(t, New(DefaultParams), authtest.Options{Vectors: vectors})
+}
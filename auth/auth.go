@@ -3,13 +3,25 @@
 package auth
 
 import (
+	"context"
+	"sync"
+
 	"github.com/pkg/errors"
 )
 
 var (
-	registry = map[string]ComputerVerifier{}
+	registryLock sync.RWMutex
+	registry     = map[string]*entry{}
+	aliases      = map[string]string{}
 )
 
+// entry is a registered auth type and its settings.
+type entry struct {
+	cv         ComputerVerifier
+	gov        *governor
+	deprecated bool
+}
+
 type InvalidType interface {
 	IsInvalidType() bool
 }
@@ -39,10 +51,44 @@ func (i *invalidAuthType) IsInvalidType() bool {
 	return true
 }
 
+// Corrupt can be implemented by errors to indicate that a stored challenge
+// is malformed and can't be verified against any attempt.
+type Corrupt interface {
+	IsCorrupt() bool
+}
+
+// IsCorrupt checks whether or not an error indicates a malformed stored
+// challenge.
+func IsCorrupt(err error) bool {
+	if c, ok := errors.Cause(err).(Corrupt); ok {
+		return c.IsCorrupt()
+	}
+	return false
+}
+
+// CorruptError is a general purpose error returned by Verifiers to indicate
+// that a stored challenge is malformed.
+type CorruptError struct {
+	Str string
+}
+
+// Error returns the string representation of the error.
+func (c CorruptError) Error() string {
+	return "corrupt challenge: " + c.Str
+}
+
+// IsCorrupt indicates that the challenge is malformed.
+func (c CorruptError) IsCorrupt() bool {
+	return true
+}
+
 // Verifier objects can take a stored authentication challenge (e.g. a hash)
-// and determine if the provided attempt value matches.
+// and determine if the provided attempt value matches. A wrong attempt is
+// reported as false with no error. An error is returned only if the attempt
+// couldn't be checked, in which case the result is always false; a malformed
+// challenge should be reported with an error satisfying IsCorrupt.
 type Verifier interface {
-	Verify(challenge, attempt []byte) bool
+	Verify(challenge, attempt []byte) (bool, error)
 }
 
 // Computer objects can take a user-supplied value and compute an
@@ -58,32 +104,63 @@ type ComputerVerifier interface {
 	Verifier
 }
 
+// Rehasher can optionally be implemented by a ComputerVerifier to indicate
+// that a stored challenge was computed with weaker parameters than the
+// ComputerVerifier would use now and should be recomputed.
+type Rehasher interface {
+	NeedsRehash(challenge []byte) bool
+}
+
+// Validator can optionally be implemented by a ComputerVerifier to reject
+// unsafe parameters when it is registered.
+type Validator interface {
+	Validate() error
+}
+
 // Register is called by the init() functions of authentication modules to
-// register those modules at run time. Supplied names must be unique.
+// register those modules at run time. Applications may also register their
+// own profiles built with a module's constructor. Supplied names must be
+// unique among auth types and aliases. If cv implements Validator, it must
+// validate successfully. Register is safe for concurrent use.
 func Register(name string, cv ComputerVerifier) error {
-	if _, present := registry[name]; present {
+	if v, ok := cv.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return errors.Wrap(err, "invalid ComputerVerifier "+name)
+		}
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if taken(name) {
 		return errors.New("duplicate ComputerVerifier: " + name)
 	}
-	registry[name] = cv
+	registry[name] = &entry{cv: cv}
 	return nil
 }
 
 // Verify takes a precomputed authentication challenge and compares it to a
-// supplied input to see if they match.
+// supplied input to see if they match. If Limits are set for authtype, an
+// error satisfying IsBusy is returned when they are exceeded.
 func Verify(authtype string, challenge, attempt []byte) (bool, error) {
-	cv, ok := registry[authtype]
-	if !ok {
-		return false, &invalidAuthType{authtype}
-	}
-	return cv.Verify(challenge, attempt), nil
+	return VerifyContext(context.Background(), authtype, challenge, attempt)
 }
 
 // Compute takes a supplied value and transforms it into an authentication
-// challenge using the supplied authtype.
+// challenge using the supplied authtype. If Limits are set for authtype, an
+// error satisfying IsBusy is returned when they are exceeded.
 func Compute(authtype string, v []byte) ([]byte, error) {
-	cv, ok := registry[authtype]
+	return ComputeContext(context.Background(), authtype, v)
+}
+
+// NeedsRehash determines whether a challenge should be recomputed because it
+// was computed with weaker parameters than authtype currently uses. Auth types
+// that don't implement Rehasher never need a rehash.
+func NeedsRehash(authtype string, challenge []byte) (bool, error) {
+	e, ok := lookup(authtype)
 	if !ok {
-		return nil, &invalidAuthType{authtype}
+		return false, &invalidAuthType{authtype}
+	}
+	if r, ok := e.cv.(Rehasher); ok {
+		return r.NeedsRehash(challenge), nil
 	}
-	return cv.Compute(v)
+	return false, nil
 }
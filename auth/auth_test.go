@@ -2,7 +2,10 @@ package auth
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"testing"
+	"time"
 )
 
 type TestAuth struct{}
@@ -15,9 +18,9 @@ func (t *TestAuth) Compute(v []byte) ([]byte, error) {
 	return x, nil
 }
 
-func (t *TestAuth) Verify(challenge, attempt []byte) bool {
+func (t *TestAuth) Verify(challenge, attempt []byte) (bool, error) {
 	x, _ := t.Compute(attempt)
-	return bytes.Equal(challenge, x)
+	return bytes.Equal(challenge, x), nil
 }
 
 func TestDupRegister(t *testing.T) {
@@ -29,6 +32,23 @@ func TestDupRegister(t *testing.T) {
 	}
 }
 
+type InvalidAuth struct {
+	TestAuth
+}
+
+func (i *InvalidAuth) Validate() error {
+	return errors.New("invalid parameters")
+}
+
+func TestInvalidRegister(t *testing.T) {
+	if err := Register("invalidtest", &InvalidAuth{}); err == nil {
+		t.Fatal("expected error on invalid registration, got none")
+	}
+	if _, err := Compute("invalidtest", []byte("test")); !IsInvalidType(err) {
+		t.Fatalf("Expected invalid type error after rejected registration, got %q", err)
+	}
+}
+
 func TestNotRegistered(t *testing.T) {
 	c := []byte("test challenge")
 	a := []byte("test attempt")
@@ -39,3 +59,160 @@ func TestNotRegistered(t *testing.T) {
 		t.Fatalf("Expected invalid type error in Compute, got %q", err)
 	}
 }
+
+// BlockAuth computes nothing until its channel is closed.
+type BlockAuth struct {
+	TestAuth
+	Unblock chan struct{}
+}
+
+func (b *BlockAuth) Compute(v []byte) ([]byte, error) {
+	<-b.Unblock
+	return b.TestAuth.Compute(v)
+}
+
+func (b *BlockAuth) MemoryCost() uint64 {
+	return 1 << 20
+}
+
+func TestLimits(t *testing.T) {
+	b := &BlockAuth{Unblock: make(chan struct{})}
+	if err := Register("limittest", b); err != nil {
+		t.Fatalf("unexpected error registering: %q", err)
+	}
+	if err := SetLimits("limittest", Limits{MaxMemory: 2 << 20, MaxQueue: 1, Timeout: 20 * time.Millisecond}); err != nil {
+		t.Fatalf("unexpected error setting limits: %q", err)
+	}
+	done := make(chan error, 3)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := Compute("limittest", []byte("test"))
+			done <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	// Two computations fit in the memory budget; a third waits and times
+	// out, and a fourth doesn't fit in the queue.
+	go func() {
+		_, err := Compute("limittest", []byte("test"))
+		done <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if _, err := Compute("limittest", []byte("test")); !IsBusy(err) {
+		t.Fatalf("expected busy error with full queue, got %v", err)
+	}
+	if err := <-done; !IsBusy(err) {
+		t.Fatalf("expected busy error after queue timeout, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := ComputeContext(ctx, "limittest", []byte("test")); err != context.Canceled {
+		t.Fatalf("expected cancellation while queued, got %v", err)
+	}
+	close(b.Unblock)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error from admitted computation: %q", err)
+		}
+	}
+	if _, err := Compute("limittest", []byte("test")); err != nil {
+		t.Fatalf("unexpected error after computations finished: %q", err)
+	}
+}
+
+func TestUnlimitedQueue(t *testing.T) {
+	b := &BlockAuth{Unblock: make(chan struct{})}
+	if err := Register("queuetest", b); err != nil {
+		t.Fatalf("unexpected error registering: %q", err)
+	}
+	if err := SetLimits("queuetest", Limits{MaxInFlight: 1}); err != nil {
+		t.Fatalf("unexpected error setting limits: %q", err)
+	}
+	// With no MaxQueue, callers beyond MaxInFlight wait rather than being
+	// refused.
+	done := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := Compute("queuetest", []byte("test"))
+			done <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(b.Unblock)
+	for i := 0; i < 5; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error from queued computation: %q", err)
+		}
+	}
+}
+
+func TestAlias(t *testing.T) {
+	if err := Register("aliastest", &TestAuth{}); err != nil {
+		t.Fatalf("unexpected error registering: %q", err)
+	}
+	if err := Alias("aliasold", "aliastest"); err != nil {
+		t.Fatalf("unexpected error aliasing: %q", err)
+	}
+	if err := Alias("aliasold", "aliastest"); err == nil {
+		t.Fatal("expected error on duplicate alias, got none")
+	}
+	if err := Register("aliasold", &TestAuth{}); err == nil {
+		t.Fatal("expected error registering alias name, got none")
+	}
+	if err := Alias("aliasmissing", "NoSuchAuthType"); !IsInvalidType(err) {
+		t.Fatalf("expected invalid type error aliasing unregistered type, got %v", err)
+	}
+	c, _ := Compute("aliastest", []byte("test"))
+	if ok, err := Verify("aliasold", c, []byte("test")); err != nil || !ok {
+		t.Fatalf("expected challenge to verify through alias, got %v", err)
+	}
+	if Canonical("aliasold") != "aliastest" || Canonical("aliastest") != "aliastest" {
+		t.Fatal("expected alias to resolve to canonical name")
+	}
+	for _, name := range List() {
+		if name == "aliasold" {
+			t.Fatal("expected List to exclude aliases")
+		}
+	}
+	if cv, ok := Lookup("aliasold"); !ok || cv == nil {
+		t.Fatal("expected Lookup to resolve alias")
+	}
+
+	if IsDeprecated("aliastest") {
+		t.Fatal("expected new auth type not to be deprecated")
+	}
+	if err := Deprecate("aliasold"); err != nil {
+		t.Fatalf("unexpected error deprecating: %q", err)
+	}
+	if !IsDeprecated("aliastest") || !IsDeprecated("aliasold") {
+		t.Fatal("expected auth type and alias to be deprecated")
+	}
+	i, err := Describe("aliasold")
+	if err != nil || i.Name != "aliastest" || len(i.Aliases) != 1 || !i.Deprecated {
+		t.Fatalf("unexpected description %+v, %v", i, err)
+	}
+}
+
+func TestConcurrentRegister(t *testing.T) {
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			err := Register("concurrenttest", &TestAuth{})
+			Compute("concurrenttest", []byte("test"))
+			List()
+			done <- err
+		}()
+	}
+	registered := 0
+	for i := 0; i < 8; i++ {
+		if err := <-done; err == nil {
+			registered++
+		}
+	}
+	if registered != 1 {
+		t.Fatalf("expected exactly one registration to succeed, got %d", registered)
+	}
+}
@@ -0,0 +1,187 @@
+// package authtest provides a conformance suite for ComputerVerifier
+// implementations. Every module shipped with dontusepasswords runs it, and
+// applications can run their own profiles and modules through it too:
+//
+//	func TestConformance(t *testing.T) {
+//		authtest.Run(t, scrypt.New(myParams), authtest.Options{})
+//	}
+package authtest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/AgentZombie/dontusepasswords/auth"
+)
+
+const (
+	password = "correct horse battery staple"
+
+	// longLen is the length of the very long input. Modules may refuse it
+	// with an error, as bcrypt does, but mustn't silently truncate it.
+	longLen = 4096
+
+	// mutations is the most positions of a stored challenge altered by the
+	// non-malleability check, which costs one verification each.
+	mutations = 16
+)
+
+// Vector is a known answer: a stored challenge and the value it was
+// computed from, produced by an independent implementation.
+type Vector struct {
+	Challenge []byte
+	Value     []byte
+}
+
+// Options control which checks Run performs.
+type Options struct {
+	Vectors    []Vector // Known answers that must verify
+	VerifyOnly bool     // Whether cv can't compute challenges; only Vectors are checked
+}
+
+// Run checks that cv behaves as dontusepasswords expects:
+//
+//   - computed challenges verify the value they were computed from
+//   - wrong, truncated, and extended values don't verify, without error;
+//     trailing NUL bytes aren't checked because HMAC, and so PBKDF2 and
+//     scrypt, ignore them
+//   - computing the same value twice gives different, salted challenges
+//   - empty and very long values are handled
+//   - each of Options.Vectors verifies its value and no other
+//   - altering any part of a stored challenge, or adding to it, stops it
+//     verifying; truncation isn't checked because PHC strings imply the key
+//     length from its encoding, so modules should enforce a minimum
+//   - fresh challenges don't need a rehash, if cv implements auth.Rehasher
+func Run(t *testing.T, cv auth.ComputerVerifier, o Options) {
+	t.Helper()
+	if !o.VerifyOnly {
+		t.Run("RoundTrip", func(t *testing.T) { roundTrip(t, cv) })
+		t.Run("WrongValue", func(t *testing.T) { wrongValue(t, cv) })
+		t.Run("Salted", func(t *testing.T) { salted(t, cv) })
+		t.Run("Empty", func(t *testing.T) { empty(t, cv) })
+		t.Run("Long", func(t *testing.T) { long(t, cv) })
+		t.Run("Rehash", func(t *testing.T) { rehash(t, cv) })
+	}
+	if len(o.Vectors) > 0 {
+		t.Run("KnownAnswer", func(t *testing.T) { knownAnswer(t, cv, o.Vectors) })
+	}
+	t.Run("NonMalleable", func(t *testing.T) { nonMalleable(t, cv, o) })
+}
+
+func compute(t *testing.T, cv auth.ComputerVerifier, v []byte) []byte {
+	t.Helper()
+	c, err := cv.Compute(v)
+	if err != nil {
+		t.Fatalf("unexpected error computing challenge: %q", err)
+	}
+	return c
+}
+
+// expect checks that verifying attempt against challenge gives want with no
+// error.
+func expect(t *testing.T, cv auth.ComputerVerifier, challenge, attempt []byte, want bool) {
+	t.Helper()
+	ok, err := cv.Verify(challenge, attempt)
+	if err != nil {
+		t.Fatalf("unexpected error verifying %q: %q", attempt, err)
+	}
+	if ok != want {
+		t.Fatalf("expected verification of %q to be %t, got %t", attempt, want, ok)
+	}
+}
+
+func roundTrip(t *testing.T, cv auth.ComputerVerifier) {
+	c := compute(t, cv, []byte(password))
+	expect(t, cv, c, []byte(password), true)
+}
+
+func wrongValue(t *testing.T, cv auth.ComputerVerifier) {
+	c := compute(t, cv, []byte(password))
+	for _, v := range []string{
+		"",
+		"Correct horse battery staple",
+		password[:len(password)-1],
+		password + "!",
+		"correct\x00horse battery staple",
+	} {
+		expect(t, cv, c, []byte(v), false)
+	}
+}
+
+func salted(t *testing.T, cv auth.ComputerVerifier) {
+	c1 := compute(t, cv, []byte(password))
+	c2 := compute(t, cv, []byte(password))
+	if bytes.Equal(c1, c2) {
+		t.Fatal("expected challenges for the same value to differ")
+	}
+	expect(t, cv, c2, []byte(password), true)
+}
+
+func empty(t *testing.T, cv auth.ComputerVerifier) {
+	c := compute(t, cv, nil)
+	expect(t, cv, c, []byte{}, true)
+	expect(t, cv, c, []byte(" "), false)
+	expect(t, cv, c, []byte(password), false)
+}
+
+func long(t *testing.T, cv auth.ComputerVerifier) {
+	v := make([]byte, longLen)
+	for i := range v {
+		v[i] = byte('a' + i%26)
+	}
+	c, err := cv.Compute(v)
+	if err != nil {
+		t.Logf("%d byte value refused: %q", longLen, err)
+		return
+	}
+	expect(t, cv, c, v, true)
+	other := append([]byte(nil), v...)
+	other[len(other)-1] = '!'
+	expect(t, cv, c, other, false)
+}
+
+func rehash(t *testing.T, cv auth.ComputerVerifier) {
+	r, ok := cv.(auth.Rehasher)
+	if !ok {
+		t.Skip("not a Rehasher")
+	}
+	if r.NeedsRehash(compute(t, cv, []byte(password))) {
+		t.Fatal("expected fresh challenge not to need rehash")
+	}
+}
+
+func knownAnswer(t *testing.T, cv auth.ComputerVerifier, vectors []Vector) {
+	for _, v := range vectors {
+		expect(t, cv, v.Challenge, v.Value, true)
+		expect(t, cv, v.Challenge, append(append([]byte(nil), v.Value...), 'x'), false)
+	}
+}
+
+// nonMalleable alters stored challenges and checks they no longer verify.
+// Errors are allowed since the altered challenge may be malformed.
+func nonMalleable(t *testing.T, cv auth.ComputerVerifier, o Options) {
+	vectors := o.Vectors
+	if !o.VerifyOnly {
+		vectors = append(vectors, Vector{compute(t, cv, []byte(password)), []byte(password)})
+	}
+	for _, v := range vectors {
+		c := v.Challenge
+		step := (len(c) + mutations - 1) / mutations
+		for i := 0; i < len(c); i += step {
+			m := append([]byte(nil), c...)
+			// XOR with 0x10 changes a significant bit of any base64 or
+			// hex digit rather than padding bits, which some encodings
+			// don't check.
+			m[i] ^= 0x10
+			if ok, _ := cv.Verify(m, v.Value); ok {
+				t.Fatalf("expected challenge altered at byte %d to fail: %q", i, m)
+			}
+		}
+		if ok, _ := cv.Verify(nil, v.Value); ok {
+			t.Fatal("expected empty challenge to fail")
+		}
+		if ok, _ := cv.Verify(append(append([]byte(nil), c...), 'A'), v.Value); ok {
+			t.Fatal("expected challenge with extra byte to fail")
+		}
+	}
+}
@@ -1,8 +1,14 @@
 // package bcrypt implements the bcrypt algorithm as an authentication method. Normally this package is imported only for side-effects:
 //    import _ "dontusepasswords/auth/bcrypt"
+//
+// Additional profiles can be registered under application-chosen names:
+//    auth.Register("BCRYPT12", bcrypt.New(12))
 package bcrypt
 
 import (
+	"strconv"
+
+	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/AgentZombie/dontusepasswords/auth"
@@ -10,19 +16,64 @@ import (
 
 const (
 	BcryptDefault = "BCRYPTDEFAULT" // Default-strength bcrypt
+
+	MinCost = bcrypt.DefaultCost // The lowest cost accepted at registration
+
+	hashLen = 60
 )
 
 func init() {
-	def := cost(bcrypt.DefaultCost)
-	auth.Register(BcryptDefault, &def)
+	auth.Register(BcryptDefault, New(bcrypt.DefaultCost))
+}
+
+// Bcrypt computes and verifies bcrypt challenges at a fixed cost.
+type Bcrypt struct {
+	cost int
+}
+
+// New creates a Bcrypt with the given cost. The cost is validated when the
+// Bcrypt is registered with auth.Register.
+func New(cost int) *Bcrypt {
+	return &Bcrypt{cost: cost}
+}
+
+// Cost returns the cost used to compute new challenges.
+func (b *Bcrypt) Cost() int {
+	return b.cost
 }
 
-type cost int
+func (b *Bcrypt) Verify(challenge, attempt []byte) (bool, error) {
+	// The bcrypt package ignores anything after the hash.
+	if len(challenge) != hashLen {
+		return false, &auth.CorruptError{Str: "wrong length for bcrypt hash"}
+	}
+	err := bcrypt.CompareHashAndPassword(challenge, attempt)
+	switch err {
+	case nil:
+		return true, nil
+	case bcrypt.ErrMismatchedHashAndPassword:
+		return false, nil
+	}
+	return false, &auth.CorruptError{Str: err.Error()}
+}
+
+func (b *Bcrypt) Compute(v []byte) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(v, b.cost)
+}
 
-func (c *cost) Verify(challenge, attempt []byte) bool {
-	return bcrypt.CompareHashAndPassword(challenge, attempt) == nil
+// NeedsRehash reports whether the challenge was computed with a lower cost
+// than b. bcrypt challenges already record their cost so no PHC encoding is
+// used.
+func (b *Bcrypt) NeedsRehash(challenge []byte) bool {
+	stored, err := bcrypt.Cost(challenge)
+	return err != nil || stored < b.cost
 }
 
-func (c *cost) Compute(v []byte) ([]byte, error) {
-	return bcrypt.GenerateFromPassword(v, int(*c))
+// Validate rejects costs below MinCost or above bcrypt's maximum.
+func (b *Bcrypt) Validate() error {
+	if b.cost < MinCost || b.cost > bcrypt.MaxCost {
+		return errors.New("bcrypt cost " + strconv.Itoa(b.cost) + " outside of " +
+			strconv.Itoa(MinCost) + "-" + strconv.Itoa(bcrypt.MaxCost))
+	}
+	return nil
 }
@@ -0,0 +1,17 @@
+package bcrypt
+
+import (
+	"testing"
+
+	"github.com/AgentZombie/dontusepasswords/auth/authtest"
+)
+
+// From the OpenBSD bcrypt tests.
+var vectors = []authtest.Vector{
+	{Challenge: []byte("$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"), Value: []byte("U*U")},
+	{Challenge: []byte("$2a$05$CCCCCCCCCCCCCCCCCCCCC.VGOzA784oUp/Z0DY336zx7pLYAy0lwK"), Value: []byte("U*U*")},
+}
+
+func TestConformance(t *testing.T) {
+	authtest.Run(t, New(MinCost), authtest.Options{Vectors: vectors})
+}
@@ -0,0 +1,91 @@
+// package calibrate benchmarks the host to recommend parameters for each
+// hashing algorithm family such that computing a challenge takes about a
+// target duration without exceeding a memory ceiling. The recommendations are
+// printed as Go source that registers the profile with auth.Register.
+package calibrate
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/auth"
+)
+
+const calibrationPassword = "correct horse battery staple"
+
+var families = []Family{Bcrypt{}, Scrypt{}, Argon2id{}, PBKDF2{}}
+
+// Config controls the parameter search.
+type Config struct {
+	Target    time.Duration // The desired time to compute one challenge
+	MaxMemory uint64        // The most memory one computation may use, in bytes
+	Samples   int           // How many times to measure each candidate; the fastest is used
+}
+
+// Result is a recommended profile for one algorithm family.
+type Result struct {
+	Family     string                // The algorithm family, e.g. "scrypt"
+	Name       string                // The suggested auth type name
+	Duration   time.Duration         // The measured time to compute a challenge
+	Memory     uint64                // Approximate memory used per computation, in bytes
+	Definition string                // Go source registering the profile under Name
+	CV         auth.ComputerVerifier // The recommended profile
+}
+
+// Family searches the parameter space of one algorithm family.
+type Family interface {
+	Name() string
+	Calibrate(c Config) (*Result, error)
+}
+
+// Register adds a Family to the set calibrated by All.
+func Register(f Family) {
+	families = append(families, f)
+}
+
+// Families returns the registered families.
+func Families() []Family {
+	return append([]Family(nil), families...)
+}
+
+// All calibrates every registered family.
+func All(c Config) ([]*Result, error) {
+	results := []*Result{}
+	for _, f := range families {
+		r, err := f.Calibrate(c)
+		if err != nil {
+			return results, errors.Wrap(err, "calibrating "+f.Name())
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// Measure returns the fastest of c.Samples computations using cv.
+func Measure(cv auth.Computer, c Config) (time.Duration, error) {
+	samples := c.Samples
+	if samples < 1 {
+		samples = 1
+	}
+	var best time.Duration
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		if _, err := cv.Compute([]byte(calibrationPassword)); err != nil {
+			return 0, err
+		}
+		d := time.Since(start)
+		if i == 0 || d < best {
+			best = d
+		}
+	}
+	return best, nil
+}
+
+// profileName suggests an auth type name such as SCRYPT250MS.
+func profileName(family string, target time.Duration) string {
+	return strings.ToUpper(strings.Replace(family, "-", "", -1)) +
+		strconv.FormatInt(int64(target/time.Millisecond), 10) + "MS"
+}
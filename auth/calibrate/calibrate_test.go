@@ -0,0 +1,39 @@
+package calibrate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalibrate(t *testing.T) {
+	c := Config{Target: time.Millisecond, MaxMemory: 64 << 20, Samples: 1}
+	for _, f := range Families() {
+		r, err := f.Calibrate(c)
+		if err != nil {
+			t.Fatalf("%s: unexpected error calibrating: %q", f.Name(), err)
+		}
+		if r.Memory > c.MaxMemory {
+			t.Fatalf("%s: expected memory under %d, got %d", f.Name(), c.MaxMemory, r.Memory)
+		}
+		if r.Name != profileName(f.Name(), c.Target) || r.Definition == "" || r.CV == nil {
+			t.Fatalf("%s: unexpected result %+v", f.Name(), r)
+		}
+		if _, err := r.CV.Compute([]byte("password")); err != nil {
+			t.Fatalf("%s: unexpected error computing with result: %q", f.Name(), err)
+		}
+	}
+}
+
+func TestBelowMinimumMemory(t *testing.T) {
+	c := Config{Target: time.Millisecond, MaxMemory: 1 << 20, Samples: 1}
+	for _, f := range []Family{Scrypt{}, Argon2id{}} {
+		if _, err := f.Calibrate(c); err == nil {
+			t.Fatalf("%s: expected error with memory ceiling below minimum, got none", f.Name())
+		}
+	}
+	for _, f := range []Family{Bcrypt{}, PBKDF2{}} {
+		if _, err := f.Calibrate(c); err != nil {
+			t.Fatalf("%s: unexpected error with small memory ceiling: %q", f.Name(), err)
+		}
+	}
+}
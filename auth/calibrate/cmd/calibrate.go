@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/AgentZombie/dontusepasswords/auth/calibrate"
+)
+
+func main() {
+	target := flag.Duration("target", 250*time.Millisecond, "desired time to compute one challenge")
+	maxMem := flag.Uint64("maxmem", 256, "maximum memory per computation in MiB")
+	samples := flag.Int("samples", 3, "measurements per candidate")
+	family := flag.String("family", "", "calibrate only this family (default all)")
+	flag.Parse()
+
+	c := calibrate.Config{
+		Target:    *target,
+		MaxMemory: *maxMem * 1024 * 1024,
+		Samples:   *samples,
+	}
+	found := false
+	for _, f := range calibrate.Families() {
+		if *family != "" && f.Name() != *family {
+			continue
+		}
+		found = true
+		r, err := f.Calibrate(c)
+		if err != nil {
+			log.Fatalf("error: calibrating %s: %s", f.Name(), err)
+		}
+		fmt.Printf("// %s: %s, %d MiB\n", r.Family, r.Duration.Round(time.Millisecond), r.Memory/(1024*1024))
+		fmt.Println(r.Definition)
+	}
+	if !found {
+		log.Fatalf("error: unknown family %q", *family)
+	}
+}
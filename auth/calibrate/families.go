@@ -0,0 +1,194 @@
+package calibrate
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	gobcrypt "golang.org/x/crypto/bcrypt"
+
+	"github.com/AgentZombie/dontusepasswords/auth/argon2"
+	"github.com/AgentZombie/dontusepasswords/auth/bcrypt"
+	"github.com/AgentZombie/dontusepasswords/auth/pbkdf2"
+	"github.com/AgentZombie/dontusepasswords/auth/scrypt"
+)
+
+// Bcrypt calibrates the bcrypt cost. bcrypt uses a small, fixed amount of
+// memory so only the target duration is considered.
+type Bcrypt struct{}
+
+func (Bcrypt) Name() string {
+	return "bcrypt"
+}
+
+func (b Bcrypt) Calibrate(c Config) (*Result, error) {
+	cost := bcrypt.MinCost
+	d, err := Measure(bcrypt.New(cost), c)
+	if err != nil {
+		return nil, err
+	}
+	// Each increment of the cost doubles the work.
+	for cost < gobcrypt.MaxCost && d*2 <= c.Target {
+		cost++
+		if d, err = Measure(bcrypt.New(cost), c); err != nil {
+			return nil, err
+		}
+	}
+	name := profileName(b.Name(), c.Target)
+	return &Result{
+		Family:     b.Name(),
+		Name:       name,
+		Duration:   d,
+		Memory:     4 * 1024,
+		Definition: fmt.Sprintf("auth.Register(%q, bcrypt.New(%d))", name, cost),
+		CV:         bcrypt.New(cost),
+	}, nil
+}
+
+// Scrypt calibrates scrypt by raising N as far as the memory ceiling and
+// target allow, then raising P to use up any remaining time. It fails if the
+// ceiling is below the memory of scrypt.MinParams.
+type Scrypt struct{}
+
+func (Scrypt) Name() string {
+	return "scrypt"
+}
+
+func scryptMemory(p scrypt.Params) uint64 {
+	return scrypt.New(p).MemoryCost()
+}
+
+// belowMinimum is the error for a memory ceiling too low for a family's
+// weakest accepted parameters.
+func belowMinimum(need uint64) error {
+	return errors.New("memory ceiling below minimum of " + strconv.FormatUint(need, 10) + " bytes")
+}
+
+func (s Scrypt) Calibrate(c Config) (*Result, error) {
+	p := scrypt.DefaultParams
+	p.N = scrypt.MinParams.N
+	if scryptMemory(p) > c.MaxMemory {
+		return nil, belowMinimum(scryptMemory(p))
+	}
+	d, err := Measure(scrypt.New(p), c)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		next := p
+		next.N *= 2
+		if scryptMemory(next) > c.MaxMemory || d*2 > c.Target {
+			break
+		}
+		p = next
+		if d, err = Measure(scrypt.New(p), c); err != nil {
+			return nil, err
+		}
+	}
+	if d > 0 && d*2 <= c.Target {
+		// Parallelization doesn't increase memory use in this
+		// implementation, only time.
+		p.P = int(c.Target / d)
+		if d, err = Measure(scrypt.New(p), c); err != nil {
+			return nil, err
+		}
+	}
+	name := profileName(s.Name(), c.Target)
+	return &Result{
+		Family:   s.Name(),
+		Name:     name,
+		Duration: d,
+		Memory:   scryptMemory(p),
+		Definition: fmt.Sprintf("auth.Register(%q, scrypt.New(scrypt.Params{N: %d, R: %d, P: %d, KeyLen: %d, SaltLen: %d}))",
+			name, p.N, p.R, p.P, p.KeyLen, p.SaltLen),
+		CV: scrypt.New(p),
+	}, nil
+}
+
+// Argon2id calibrates Argon2id by using as much memory as the ceiling and
+// target allow with a single pass, then adding passes to use up any
+// remaining time. It fails if the ceiling is below argon2.MinParams.Memory.
+type Argon2id struct{}
+
+func (Argon2id) Name() string {
+	return "argon2id"
+}
+
+func (a Argon2id) Calibrate(c Config) (*Result, error) {
+	p := argon2.DefaultParams
+	p.Time = 1
+	p.Threads = uint8(runtime.NumCPU())
+	if p.Threads > 4 || p.Threads == 0 {
+		p.Threads = 4
+	}
+	p.Memory = argon2.MinParams.Memory
+	if need := argon2.New(p).MemoryCost(); need > c.MaxMemory {
+		return nil, belowMinimum(need)
+	}
+	for uint64(p.Memory)*2*1024 <= c.MaxMemory && p.Memory*2 > p.Memory {
+		p.Memory *= 2
+	}
+	d, err := Measure(argon2.New(p), c)
+	if err != nil {
+		return nil, err
+	}
+	for d > c.Target && p.Memory/2 >= argon2.MinParams.Memory {
+		p.Memory /= 2
+		if d, err = Measure(argon2.New(p), c); err != nil {
+			return nil, err
+		}
+	}
+	if d > 0 && d*2 <= c.Target {
+		// Each pass takes roughly as long as the first.
+		p.Time = uint32(c.Target / d)
+		if d, err = Measure(argon2.New(p), c); err != nil {
+			return nil, err
+		}
+	}
+	name := profileName(a.Name(), c.Target)
+	return &Result{
+		Family:   a.Name(),
+		Name:     name,
+		Duration: d,
+		Memory:   argon2.New(p).MemoryCost(),
+		Definition: fmt.Sprintf("auth.Register(%q, argon2.New(argon2.Params{Time: %d, Memory: %d, Threads: %d, KeyLen: %d, SaltLen: %d}))",
+			name, p.Time, p.Memory, p.Threads, p.KeyLen, p.SaltLen),
+		CV: argon2.New(p),
+	}, nil
+}
+
+// PBKDF2 calibrates the PBKDF2-HMAC-SHA256 iteration count. PBKDF2 uses a
+// small, fixed amount of memory so only the target duration is considered.
+type PBKDF2 struct{}
+
+func (PBKDF2) Name() string {
+	return "pbkdf2"
+}
+
+func (k PBKDF2) Calibrate(c Config) (*Result, error) {
+	p := pbkdf2.DefaultSHA256Params
+	p.Iterations = pbkdf2.MinParams.Iterations
+	d, err := Measure(pbkdf2.New(p), c)
+	if err != nil {
+		return nil, err
+	}
+	if d > 0 && d < c.Target {
+		// Time is linear in the iteration count.
+		p.Iterations = int(int64(p.Iterations) * int64(c.Target) / int64(d))
+		if d, err = Measure(pbkdf2.New(p), c); err != nil {
+			return nil, err
+		}
+	}
+	name := profileName(k.Name(), c.Target)
+	return &Result{
+		Family:   k.Name(),
+		Name:     name,
+		Duration: d,
+		Memory:   4 * 1024,
+		Definition: fmt.Sprintf("auth.Register(%q, pbkdf2.New(pbkdf2.Params{Iterations: %d, SaltLen: %d, KeyLen: %d, Digest: pbkdf2.SHA256}))",
+			name, p.Iterations, p.SaltLen, p.KeyLen),
+		CV: pbkdf2.New(p),
+	}, nil
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+)
+
+// ContextComputer can optionally be implemented by a ComputerVerifier whose
+// computation can be abandoned part way through when ctx is done.
+type ContextComputer interface {
+	ComputeContext(ctx context.Context, v []byte) ([]byte, error)
+}
+
+// ContextVerifier can optionally be implemented by a ComputerVerifier whose
+// verification can be abandoned part way through when ctx is done, with
+// the same results as Verify or ctx.Err() if it was abandoned.
+type ContextVerifier interface {
+	VerifyContext(ctx context.Context, challenge, attempt []byte) (bool, error)
+}
+
+// ComputeContext is like Compute but returns ctx.Err() as soon as ctx is
+// done, including while waiting within authtype's Limits. Auth types that
+// don't implement ContextComputer are run in a separate goroutine which is
+// left to finish in the background; the caller gets control back but the
+// CPU and memory are still spent, and still count toward the Limits.
+func ComputeContext(ctx context.Context, authtype string, v []byte) ([]byte, error) {
+	e, ok := lookup(authtype)
+	if !ok {
+		return nil, &invalidAuthType{authtype}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cv, g := e.cv, e.gov
+	if err := g.acquire(ctx); err != nil {
+		return nil, err
+	}
+	if cc, ok := cv.(ContextComputer); ok {
+		defer g.release()
+		return cc.ComputeContext(ctx, v)
+	}
+	if ctx.Done() == nil {
+		// ctx can never be done, so there's no need for a goroutine.
+		defer g.release()
+		return cv.Compute(v)
+	}
+	type result struct {
+		c   []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		c, err := cv.Compute(v)
+		g.release()
+		done <- result{c, err}
+	}()
+	select {
+	case r := <-done:
+		return r.c, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// VerifyContext is like Verify but returns ctx.Err() as soon as ctx is done.
+// Auth types that don't implement ContextVerifier are handled as in
+// ComputeContext.
+func VerifyContext(ctx context.Context, authtype string, challenge, attempt []byte) (bool, error) {
+	e, ok := lookup(authtype)
+	if !ok {
+		return false, &invalidAuthType{authtype}
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	cv, g := e.cv, e.gov
+	if err := g.acquire(ctx); err != nil {
+		return false, err
+	}
+	if vc, ok := cv.(ContextVerifier); ok {
+		defer g.release()
+		return vc.VerifyContext(ctx, challenge, attempt)
+	}
+	if ctx.Done() == nil {
+		defer g.release()
+		return cv.Verify(challenge, attempt)
+	}
+	type result struct {
+		ok  bool
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ok, err := cv.Verify(challenge, attempt)
+		g.release()
+		done <- result{ok, err}
+	}()
+	select {
+	case r := <-done:
+		return r.ok, r.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
@@ -0,0 +1,67 @@
+package auth_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/AgentZombie/dontusepasswords/auth"
+	_ "github.com/AgentZombie/dontusepasswords/auth/argon2"
+	"github.com/AgentZombie/dontusepasswords/auth/bcrypt"
+	"github.com/AgentZombie/dontusepasswords/auth/legacy"
+	_ "github.com/AgentZombie/dontusepasswords/auth/pbkdf2"
+	"github.com/AgentZombie/dontusepasswords/auth/pepper"
+	_ "github.com/AgentZombie/dontusepasswords/auth/scrypt"
+	"github.com/AgentZombie/dontusepasswords/auth/wrap"
+)
+
+func init() {
+	pepper.RegisterDefaults(&pepper.Keyring{
+		Current: "fuzz",
+		Keys:    map[string][]byte{"fuzz": bytes.Repeat([]byte{1}, 32)},
+	})
+	auth.Register("WRAPFUZZ", wrap.New(legacy.MD5, bcrypt.BcryptDefault))
+}
+
+// FuzzVerify checks that no registered module panics or reports a match
+// along with an error, whatever the stored challenge.
+func FuzzVerify(f *testing.F) {
+	for _, authtype := range auth.List() {
+		c, err := auth.Compute(authtype, []byte("password"))
+		if err != nil {
+			// Verify-only types.
+			continue
+		}
+		f.Add(c, []byte("password"))
+		f.Add(c[:len(c)/2], []byte("password"))
+		f.Add(c[:len(c)-1], []byte("password"))
+	}
+	for _, c := range []string{
+		"",
+		"$",
+		"$scrypt$ln=62,r=0,p=1$c2FsdA$a2V5",
+		"$scrypt$ln=40,r=1073741824,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=4294967295,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=8,t=1,p=255$c2FsdA$a2V5",
+		"$pbkdf2-sha256$i=0$c2FsdA$a2V5",
+		"$pepper$k=fuzz$",
+		"$pepper$k=missing$$2a$10$",
+		"$wrap$$",
+		"$wrap$!!$x",
+		"$5$rounds=x$salt$hash",
+		"$1$$",
+		"{SHA}",
+		"pbkdf2_sha256$0$salt$",
+		"5f4dcc3b5aa765d61d8327deb882cf9",
+	} {
+		f.Add([]byte(c), []byte("password"))
+	}
+	types := auth.List()
+	f.Fuzz(func(t *testing.T, challenge, attempt []byte) {
+		for _, authtype := range types {
+			ok, err := auth.Verify(authtype, challenge, attempt)
+			if ok && err != nil {
+				t.Fatalf("%s: verified with error %q", authtype, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limits bound the hashing work done at once for one auth type, so that a
+// flood of logins can't exhaust CPU or memory. Zero values mean no limit.
+type Limits struct {
+	MaxInFlight int           // Computations allowed to run at once
+	MaxMemory   uint64        // Bytes all running computations may use together; see MemoryCoster
+	MaxQueue    int           // Callers allowed to wait for a running computation to finish
+	Timeout     time.Duration // How long a caller may wait before giving up
+}
+
+// MemoryCoster can optionally be implemented by a ComputerVerifier to report
+// roughly how many bytes of memory one computation uses, for MaxMemory.
+// Verifying a challenge stored with different parameters is assumed to
+// cost the same.
+type MemoryCoster interface {
+	MemoryCost() uint64
+}
+
+// Busy can be implemented by errors to indicate that an auth type is
+// already doing as much work as its Limits allow.
+type Busy interface {
+	IsBusy() bool
+}
+
+// IsBusy checks whether or not an error indicates that a computation was
+// refused because of an auth type's Limits. Servers should generally shed
+// load, e.g. with 503 Service Unavailable, rather than retry.
+func IsBusy(err error) bool {
+	if b, ok := errors.Cause(err).(Busy); ok {
+		return b.IsBusy()
+	}
+	return false
+}
+
+type busyError struct {
+	AuthType string
+	Reason   string
+}
+
+func (b busyError) Error() string {
+	return "auth type '" + b.AuthType + "' busy: " + b.Reason
+}
+
+func (b busyError) IsBusy() bool {
+	return true
+}
+
+// SetLimits bounds the work done at once for a registered auth type,
+// replacing any previous Limits. Like Register, it should be called before
+// the auth type is used. Limits apply to calls naming authtype or any of its
+// aliases; auth types that wrap another one, like pepper, are also subject
+// to the wrapped auth type's Limits.
+func SetLimits(authtype string, l Limits) error {
+	if l.MaxInFlight < 0 || l.MaxQueue < 0 || l.Timeout < 0 {
+		return errors.New("negative limit for auth type " + authtype)
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	e, ok := registry[resolve(authtype)]
+	if !ok {
+		return &invalidAuthType{authtype}
+	}
+	g := &governor{authtype: authtype, limits: l}
+	if mc, ok := e.cv.(MemoryCoster); ok {
+		g.cost = mc.MemoryCost()
+	}
+	e.gov = g
+	return nil
+}
+
+// governor admits computations for one auth type within its Limits. Callers
+// that can't run immediately wait in FIFO order.
+type governor struct {
+	authtype string
+	limits   Limits
+	cost     uint64
+
+	lock     sync.Mutex
+	inFlight int
+	memory   uint64
+	waiting  []chan struct{}
+}
+
+// fits reports whether another computation can start. A computation that
+// costs more than MaxMemory on its own can still run when nothing else is.
+// The lock must be held.
+func (g *governor) fits() bool {
+	l := g.limits
+	if l.MaxInFlight > 0 && g.inFlight >= l.MaxInFlight {
+		return false
+	}
+	return l.MaxMemory == 0 || g.inFlight == 0 || g.memory+g.cost <= l.MaxMemory
+}
+
+// start records a running computation. The lock must be held.
+func (g *governor) start() {
+	g.inFlight++
+	g.memory += g.cost
+}
+
+// acquire waits for room to run a computation. A nil governor always has
+// room. Each successful acquire must be followed by a release.
+func (g *governor) acquire(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.lock.Lock()
+	if len(g.waiting) == 0 && g.fits() {
+		g.start()
+		g.lock.Unlock()
+		return nil
+	}
+	if g.limits.MaxQueue > 0 && len(g.waiting) >= g.limits.MaxQueue {
+		g.lock.Unlock()
+		return busyError{g.authtype, "queue full"}
+	}
+	ready := make(chan struct{})
+	g.waiting = append(g.waiting, ready)
+	g.lock.Unlock()
+
+	var timeout <-chan time.Time
+	if g.limits.Timeout > 0 {
+		t := time.NewTimer(g.limits.Timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timeout:
+		err = busyError{g.authtype, "timed out waiting"}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for i, w := range g.waiting {
+		if w == ready {
+			g.waiting = append(g.waiting[:i], g.waiting[i+1:]...)
+			return err
+		}
+	}
+	// release already started the computation on our behalf; hand it back.
+	g.finish()
+	return err
+}
+
+// release records the end of a computation and starts waiting callers that
+// now fit.
+func (g *governor) release() {
+	if g == nil {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.finish()
+}
+
+// finish ends a computation and wakes waiting callers. The lock must be
+// held.
+func (g *governor) finish() {
+	g.inFlight--
+	g.memory -= g.cost
+	for len(g.waiting) > 0 && g.fits() {
+		g.start()
+		close(g.waiting[0])
+		g.waiting = g.waiting[1:]
+	}
+}
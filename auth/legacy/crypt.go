@@ -0,0 +1,264 @@
+package legacy
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"hash"
+	"strconv"
+)
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// b64From24 appends n characters encoding the 24 bits b2:b1:b0, least
+// significant first, as crypt(3) does.
+func b64From24(out []byte, b2, b1, b0 byte, n int) []byte {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for ; n > 0; n-- {
+		out = append(out, cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+	return out
+}
+
+// splitCrypt separates a $<id>$[rounds=<n>$]<salt>$<hash> string after its
+// magic prefix into the optional rounds field and the salt.
+func splitCrypt(challenge []byte, magic string) (rounds string, salt []byte, ok bool) {
+	if !bytes.HasPrefix(challenge, []byte(magic)) {
+		return "", nil, false
+	}
+	fields := bytes.Split(challenge[len(magic):], []byte("$"))
+	if len(fields) == 3 && bytes.HasPrefix(fields[0], []byte("rounds=")) {
+		return string(fields[0][len("rounds="):]), fields[1], true
+	}
+	if len(fields) != 2 {
+		return "", nil, false
+	}
+	return "", fields[0], true
+}
+
+func verifyMD5Crypt(challenge, attempt []byte) (bool, error) {
+	return verifyMD5Magic(challenge, attempt, "$1$")
+}
+
+func verifyAPR1(challenge, attempt []byte) (bool, error) {
+	return verifyMD5Magic(challenge, attempt, "$apr1$")
+}
+
+func verifyMD5Magic(challenge, attempt []byte, magic string) (bool, error) {
+	rounds, salt, ok := splitCrypt(challenge, magic)
+	if !ok || rounds != "" {
+		return false, corrupt("malformed MD5 crypt hash")
+	}
+	return subtle.ConstantTimeCompare(md5Crypt(attempt, salt, []byte(magic)), challenge) == 1, nil
+}
+
+// md5Crypt implements Poul-Henning Kamp's MD5 crypt, also used by Apache
+// with a different magic string.
+func md5Crypt(pw, salt, magic []byte) []byte {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write(salt)
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	d := md5.New()
+	d.Write(pw)
+	d.Write(magic)
+	d.Write(salt)
+	for i := len(pw); i > 0; i -= 16 {
+		if i > 16 {
+			d.Write(altSum)
+		} else {
+			d.Write(altSum[:i])
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	final := d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		c := md5.New()
+		if i&1 != 0 {
+			c.Write(pw)
+		} else {
+			c.Write(final)
+		}
+		if i%3 != 0 {
+			c.Write(salt)
+		}
+		if i%7 != 0 {
+			c.Write(pw)
+		}
+		if i&1 != 0 {
+			c.Write(final)
+		} else {
+			c.Write(pw)
+		}
+		final = c.Sum(nil)
+	}
+
+	out := append(append(append([]byte{}, magic...), salt...), '$')
+	for _, t := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		out = b64From24(out, final[t[0]], final[t[1]], final[t[2]], 4)
+	}
+	return b64From24(out, 0, 0, final[11], 2)
+}
+
+const (
+	shaCryptDefaultRounds = 5000
+	shaCryptMinRounds     = 1000
+	shaCryptMaxRounds     = 999999999
+	shaCryptMaxSalt       = 16
+)
+
+var sha256Perm = [][3]int{
+	{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+	{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+}
+
+var sha512Perm = [][3]int{
+	{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+	{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+	{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+	{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+	{62, 20, 41},
+}
+
+func verifySHA256Crypt(challenge, attempt []byte) (bool, error) {
+	return verifySHACrypt(challenge, attempt, "$5$", sha256.New, func(out, sum []byte) []byte {
+		for _, t := range sha256Perm {
+			out = b64From24(out, sum[t[0]], sum[t[1]], sum[t[2]], 4)
+		}
+		return b64From24(out, 0, sum[31], sum[30], 3)
+	})
+}
+
+func verifySHA512Crypt(challenge, attempt []byte) (bool, error) {
+	return verifySHACrypt(challenge, attempt, "$6$", sha512.New, func(out, sum []byte) []byte {
+		for _, t := range sha512Perm {
+			out = b64From24(out, sum[t[0]], sum[t[1]], sum[t[2]], 4)
+		}
+		return b64From24(out, 0, 0, sum[63], 2)
+	})
+}
+
+func verifySHACrypt(challenge, attempt []byte, magic string, h func() hash.Hash, encode func(out, sum []byte) []byte) (bool, error) {
+	roundsStr, salt, ok := splitCrypt(challenge, magic)
+	if !ok {
+		return false, corrupt("malformed SHA crypt hash")
+	}
+	rounds := shaCryptDefaultRounds
+	if roundsStr != "" {
+		n, err := strconv.Atoi(roundsStr)
+		if err != nil || n < 0 {
+			return false, corrupt("malformed SHA crypt rounds")
+		}
+		if n > MaxIterations {
+			return false, corrupt("SHA crypt rounds out of range")
+		}
+		rounds = n
+	}
+	c := shaCrypt(attempt, salt, magic, roundsStr != "", rounds, h, encode)
+	return subtle.ConstantTimeCompare(c, challenge) == 1, nil
+}
+
+// shaCrypt implements Ulrich Drepper's SHA-crypt for SHA-256 and SHA-512.
+func shaCrypt(pw, salt []byte, magic string, customRounds bool, rounds int, h func() hash.Hash, encode func(out, sum []byte) []byte) []byte {
+	if len(salt) > shaCryptMaxSalt {
+		salt = salt[:shaCryptMaxSalt]
+	}
+	if rounds < shaCryptMinRounds {
+		rounds = shaCryptMinRounds
+	}
+	if rounds > shaCryptMaxRounds {
+		rounds = shaCryptMaxRounds
+	}
+
+	b := h()
+	b.Write(pw)
+	b.Write(salt)
+	b.Write(pw)
+	bSum := b.Sum(nil)
+	size := len(bSum)
+
+	a := h()
+	a.Write(pw)
+	a.Write(salt)
+	i := len(pw)
+	for ; i > size; i -= size {
+		a.Write(bSum)
+	}
+	a.Write(bSum[:i])
+	for i = len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(bSum)
+		} else {
+			a.Write(pw)
+		}
+	}
+	aSum := a.Sum(nil)
+
+	dp := h()
+	for i := 0; i < len(pw); i++ {
+		dp.Write(pw)
+	}
+	p := repeatTo(dp.Sum(nil), len(pw))
+
+	ds := h()
+	for i := 0; i < 16+int(aSum[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeatTo(ds.Sum(nil), len(salt))
+
+	for r := 0; r < rounds; r++ {
+		c := h()
+		if r&1 != 0 {
+			c.Write(p)
+		} else {
+			c.Write(aSum)
+		}
+		if r%3 != 0 {
+			c.Write(s)
+		}
+		if r%7 != 0 {
+			c.Write(p)
+		}
+		if r&1 != 0 {
+			c.Write(aSum)
+		} else {
+			c.Write(p)
+		}
+		aSum = c.Sum(nil)
+	}
+
+	out := []byte(magic)
+	if customRounds {
+		out = append(out, "rounds="+strconv.Itoa(rounds)+"$"...)
+	}
+	out = append(append(out, salt...), '$')
+	return encode(out, aSum)
+}
+
+// repeatTo repeats b to fill n bytes.
+func repeatTo(b []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		if n-len(out) >= len(b) {
+			out = append(out, b...)
+		} else {
+			out = append(out, b[:n-len(out)]...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+// package legacy implements verify-only authentication modules for hashes
+// imported from other systems, so existing users can keep their passwords
+// when migrating:
+//
+//	$6$...                 SHA-512 crypt(3), e.g. from /etc/shadow
+//	$5$...                 SHA-256 crypt(3)
+//	$1$...                 MD5 crypt(3)
+//	$apr1$...              Apache MD5, from htpasswd files
+//	{SHA}...               Unsalted SHA-1, from htpasswd files
+//	pbkdf2_sha256$...      Django's default password hasher
+//	hex digest             Unsalted MD5 or SHA-1, see Raw
+//
+// Normally this package is imported only for side-effects:
+//
+//	import _ "dontusepasswords/auth/legacy"
+//
+// Imported hashes are stored as-is in Account.AuthData with the auth type
+// reported by Identify. Because these auth types differ from the configured
+// one, Accounts.Auth replaces them with a modern hash at the first successful
+// login. New challenges can't be computed with these modules.
+package legacy
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/auth"
+)
+
+const (
+	CryptSHA512        = "CRYPTSHA512"        // SHA-512 crypt(3), $6$
+	CryptSHA256        = "CRYPTSHA256"        // SHA-256 crypt(3), $5$
+	CryptMD5           = "CRYPTMD5"           // MD5 crypt(3), $1$
+	APR1               = "APR1"               // Apache MD5, $apr1$
+	HtpasswdSHA        = "HTPASSWDSHA"        // Unsalted SHA-1, {SHA}
+	DjangoPBKDF2SHA256 = "DJANGOPBKDF2SHA256" // Django PBKDF2-SHA256, pbkdf2_sha256$
+
+	// MaxAttemptLen is the longest attempt VerifyOnly checks. Longer attempts
+	// never match, because SHA crypt's work grows with the square of the
+	// attempt's length.
+	MaxAttemptLen = 4096
+)
+
+// MaxIterations is the most SHA crypt rounds or Django PBKDF2 iterations a
+// stored challenge may ask for. Challenges asking for more are treated as
+// corrupt rather than tying up a CPU.
+var MaxIterations = 10000000
+
+// verifier checks an attempt against a stored legacy hash.
+type verifier func(challenge, attempt []byte) (bool, error)
+
+var prefixes = []struct {
+	prefix   string
+	authtype string
+	verify   verifier
+}{
+	{"$6$", CryptSHA512, verifySHA512Crypt},
+	{"$5$", CryptSHA256, verifySHA256Crypt},
+	{"$1$", CryptMD5, verifyMD5Crypt},
+	{"$apr1$", APR1, verifyAPR1},
+	{"{SHA}", HtpasswdSHA, verifyHtpasswdSHA},
+	{"pbkdf2_sha256$", DjangoPBKDF2SHA256, verifyDjango},
+}
+
+func init() {
+	for _, p := range prefixes {
+		auth.Register(p.authtype, VerifyOnly(p.verify))
+	}
+}
+
+// VerifyOnly is a ComputerVerifier that can only verify existing
+// challenges. Attempts longer than MaxAttemptLen are rejected without being
+// hashed.
+type VerifyOnly func(challenge, attempt []byte) (bool, error)
+
+func (v VerifyOnly) Verify(challenge, attempt []byte) (bool, error) {
+	if len(attempt) > MaxAttemptLen {
+		return false, nil
+	}
+	return v(challenge, attempt)
+}
+
+func (v VerifyOnly) Compute(b []byte) ([]byte, error) {
+	return nil, errors.New("legacy auth types are verify-only")
+}
+
+// corrupt returns an error satisfying auth.IsCorrupt for a malformed legacy
+// hash.
+func corrupt(s string) error {
+	return &auth.CorruptError{Str: s}
+}
+
+// Identify returns the auth type of an imported hash based on its format.
+func Identify(hash []byte) (string, error) {
+	for _, p := range prefixes {
+		if bytes.HasPrefix(hash, []byte(p.prefix)) {
+			return p.authtype, nil
+		}
+	}
+	return "", errors.New("unrecognized legacy hash format")
+}
@@ -0,0 +1,110 @@
+package legacy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AgentZombie/dontusepasswords/auth"
+	"github.com/AgentZombie/dontusepasswords/auth/authtest"
+)
+
+// Vectors from openssl passwd, Python's hashlib, and the SHA-crypt
+// specification.
+var vectors = []struct {
+	authtype, hash, password string
+}{
+	{CryptMD5, "$1$saltstri$YMyguxXMBpd2TEZ.vS/3q1", "Hello world!"},
+	{CryptMD5, "$1$abc$Or2rbeUYTvt12aiVzMuS/.", ""},
+	{APR1, "$apr1$saltstri$aGfuB7Lcvs2TUeFTqUVfN0", "Hello world!"},
+	{CryptSHA256, "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world!"},
+	{CryptSHA256, "$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA", "Hello world!"},
+	{CryptSHA512, "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!"},
+	{HtpasswdSHA, "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "password"},
+	{DjangoPBKDF2SHA256, "pbkdf2_sha256$1000$seasalt$YIWkt6M1JFXrHg5s0jZjBSc7C2Cz6QvchSJ0h8Y+i7c=", "password"},
+}
+
+func TestVectors(t *testing.T) {
+	for _, v := range vectors {
+		authtype, err := Identify([]byte(v.hash))
+		if err != nil || authtype != v.authtype {
+			t.Fatalf("%s: expected type %s, got %s (%v)", v.hash, v.authtype, authtype, err)
+		}
+		if ok, err := auth.Verify(authtype, []byte(v.hash), []byte(v.password)); err != nil || !ok {
+			t.Fatalf("%s: expected %q to verify (%v)", v.hash, v.password, err)
+		}
+		if ok, _ := auth.Verify(authtype, []byte(v.hash), []byte(v.password+"x")); ok {
+			t.Fatalf("%s: expected wrong password not to verify", v.hash)
+		}
+	}
+}
+
+func TestVerifyOnly(t *testing.T) {
+	if _, err := auth.Compute(CryptSHA512, []byte("password")); err == nil {
+		t.Fatal("expected error computing legacy challenge, got none")
+	}
+	if _, err := Identify([]byte("$2a$10$abc")); err == nil {
+		t.Fatal("expected error identifying unsupported hash, got none")
+	}
+
+	// Hashing this with SHA crypt would take hours.
+	long := bytes.Repeat([]byte("x"), 1<<20)
+	start := time.Now()
+	ok, err := auth.Verify(CryptSHA256, []byte("$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5"), long)
+	if ok || err != nil {
+		t.Fatalf("expected long attempt not to verify, got %v, %v", ok, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expected long attempt to be rejected quickly, took %s", d)
+	}
+}
+
+func TestOutOfRange(t *testing.T) {
+	for _, v := range []struct {
+		authtype, hash string
+	}{
+		{CryptSHA256, "$5$rounds=999999999$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5"},
+		{CryptSHA512, "$6$rounds=50000000$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+		{DjangoPBKDF2SHA256, "pbkdf2_sha256$2147483647$seasalt$YIWkt6M1JFXrHg5s0jZjBSc7C2Cz6QvchSJ0h8Y+i7c="},
+		{DjangoPBKDF2SHA256, "pbkdf2_sha256$1000$seasalt$" + strings.Repeat("AAAA", 1000)},
+	} {
+		start := time.Now()
+		if _, err := auth.Verify(v.authtype, []byte(v.hash), []byte("password")); !auth.IsCorrupt(err) {
+			t.Fatalf("%s: expected corrupt error, got %v", v.hash, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("%s: expected out of range challenge to be rejected quickly, took %s", v.hash, d)
+		}
+	}
+}
+
+func TestRaw(t *testing.T) {
+	for authtype, hash := range map[string]string{
+		RawMD5:  "5F4DCC3B5AA765D61D8327DEB882CF99",
+		RawSHA1: "5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8",
+	} {
+		if ok, err := auth.Verify(authtype, []byte(hash), []byte("password")); err != nil || !ok {
+			t.Fatalf("%s: expected password to verify (%v)", authtype, err)
+		}
+		if ok, _ := auth.Verify(authtype, []byte(hash), []byte("passwore")); ok {
+			t.Fatalf("%s: expected wrong password not to verify", authtype)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	byType := map[string][]authtest.Vector{
+		RawMD5:  {{Challenge: []byte("5f4dcc3b5aa765d61d8327deb882cf99"), Value: []byte("password")}},
+		RawSHA1: {{Challenge: []byte("5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8"), Value: []byte("password")}},
+	}
+	for _, v := range vectors {
+		byType[v.authtype] = append(byType[v.authtype], authtest.Vector{Challenge: []byte(v.hash), Value: []byte(v.password)})
+	}
+	for authtype, vs := range byType {
+		cv, _ := auth.Lookup(authtype)
+		t.Run(authtype, func(t *testing.T) {
+			authtest.Run(t, cv, authtest.Options{Vectors: vs, VerifyOnly: true})
+		})
+	}
+}
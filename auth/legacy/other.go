@@ -0,0 +1,47 @@
+package legacy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strconv"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func verifyHtpasswdSHA(challenge, attempt []byte) (bool, error) {
+	sum := sha1.Sum(attempt)
+	c := append([]byte("{SHA}"), base64.StdEncoding.EncodeToString(sum[:])...)
+	if len(challenge) != len(c) || !bytes.HasPrefix(challenge, []byte("{SHA}")) {
+		return false, corrupt("malformed htpasswd SHA hash")
+	}
+	return subtle.ConstantTimeCompare(c, challenge) == 1, nil
+}
+
+// djangoMaxKeyLen bounds the length of a Django hash, as each block of key
+// takes another round of iterations. Django itself uses 32 bytes.
+const djangoMaxKeyLen = 64
+
+// verifyDjango checks Django's pbkdf2_sha256$<iterations>$<salt>$<hash>
+// format, where hash is standard base64.
+func verifyDjango(challenge, attempt []byte) (bool, error) {
+	fields := bytes.Split(challenge, []byte("$"))
+	if len(fields) != 4 || string(fields[0]) != "pbkdf2_sha256" {
+		return false, corrupt("malformed Django hash")
+	}
+	iter, err := strconv.Atoi(string(fields[1]))
+	if err != nil || iter < 1 {
+		return false, corrupt("malformed Django iterations")
+	}
+	if iter > MaxIterations {
+		return false, corrupt("Django iterations out of range")
+	}
+	want, err := base64.StdEncoding.DecodeString(string(fields[3]))
+	if err != nil || len(want) == 0 || len(want) > djangoMaxKeyLen {
+		return false, corrupt("malformed Django hash")
+	}
+	got := pbkdf2.Key(attempt, fields[2], iter, len(want), sha256.New)
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
@@ -0,0 +1,76 @@
+package legacy
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"hash"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/auth"
+)
+
+const (
+	RawMD5  = "RAWMD5"  // Unsalted MD5, hex encoded
+	RawSHA1 = "RAWSHA1" // Unsalted SHA-1, hex encoded
+)
+
+// Raw verifies bare, unsalted, hex encoded digests. These have no
+// recognizable prefix, so Identify never reports them; the importing
+// application has to know what it has.
+//
+// Raw also implements the wrap.Inner interface so that these hashes can be
+// wrapped in a modern scheme without waiting for users to log in.
+type Raw struct {
+	h func() hash.Hash
+}
+
+var (
+	MD5  = &Raw{md5.New}
+	SHA1 = &Raw{sha1.New}
+)
+
+func init() {
+	auth.Register(RawMD5, MD5)
+	auth.Register(RawSHA1, SHA1)
+}
+
+func (r *Raw) Verify(challenge, attempt []byte) (bool, error) {
+	_, want, err := r.Split(challenge)
+	if err != nil {
+		return false, corrupt(err.Error())
+	}
+	d, _ := r.Digest(nil, attempt)
+	return subtle.ConstantTimeCompare(d, want) == 1, nil
+}
+
+func (r *Raw) Compute(b []byte) ([]byte, error) {
+	return nil, errors.New("legacy auth types are verify-only")
+}
+
+// Split returns the setting and digest of a stored challenge. Raw digests
+// have no setting.
+func (r *Raw) Split(challenge []byte) (setting, digest []byte, err error) {
+	digest = bytes.ToLower(challenge)
+	if len(digest) != hex.EncodedLen(r.h().Size()) {
+		return nil, nil, errors.New("wrong length for raw digest")
+	}
+	if _, err := hex.DecodeString(string(digest)); err != nil {
+		return nil, nil, errors.Wrap(err, "decoding raw digest")
+	}
+	return nil, digest, nil
+}
+
+// Digest computes the digest of attempt as it would appear in a stored
+// challenge.
+func (r *Raw) Digest(setting, attempt []byte) ([]byte, error) {
+	h := r.h()
+	h.Write(attempt)
+	sum := h.Sum(nil)
+	d := make([]byte, hex.EncodedLen(len(sum)))
+	hex.Encode(d, sum)
+	return d, nil
+}
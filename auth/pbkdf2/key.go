@@ -0,0 +1,46 @@
+package pbkdf2
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/binary"
+	"hash"
+)
+
+// checkEvery is how many iterations run between checks for cancellation.
+const checkEvery = 4096
+
+// key derives a key as in RFC 8018, checking ctx periodically so that long
+// derivations can be abandoned. golang.org/x/crypto/pbkdf2 can't be
+// interrupted.
+func key(ctx context.Context, password, salt []byte, iter, keyLen int, h func() hash.Hash) ([]byte, error) {
+	prf := hmac.New(h, password)
+	size := prf.Size()
+	blocks := (keyLen + size - 1) / size
+	dk := make([]byte, 0, blocks*size)
+	var buf [4]byte
+	u := make([]byte, size)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-size:]
+		copy(u, t)
+		for n := 2; n <= iter; n++ {
+			if n%checkEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen], nil
+}
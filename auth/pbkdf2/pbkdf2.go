@@ -0,0 +1,223 @@
+// package pbkdf2 implements PBKDF2 with HMAC-SHA256 or HMAC-SHA512 as an
+// authentication method, for deployments restricted to FIPS-approved
+// primitives. Normally this package is imported only for side-effects:
+//
+//	import _ "dontusepasswords/auth/pbkdf2"
+//
+// Additional profiles can be registered under application-chosen names:
+//
+//	auth.Register("PBKDF2SHA512HEAVY", pbkdf2.New(pbkdf2.Params{Iterations: 1000000, SaltLen: 16, KeyLen: 64, Digest: pbkdf2.SHA512}))
+package pbkdf2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"hash"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/auth"
+	"github.com/AgentZombie/dontusepasswords/auth/phc"
+)
+
+const (
+	PBKDF2SHA256Default = "PBKDF2SHA256DEFAULT" // Default-strength PBKDF2-HMAC-SHA256
+	PBKDF2SHA512Default = "PBKDF2SHA512DEFAULT" // Default-strength PBKDF2-HMAC-SHA512
+
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+
+	phcPrefix = "pbkdf2-"
+)
+
+var (
+	// DefaultSHA256Params are the parameters of the PBKDF2SHA256Default
+	// profile.
+	DefaultSHA256Params = Params{
+		Iterations: 600000,
+		SaltLen:    16,
+		KeyLen:     32,
+		Digest:     SHA256,
+	}
+
+	// DefaultSHA512Params are the parameters of the PBKDF2SHA512Default
+	// profile.
+	DefaultSHA512Params = Params{
+		Iterations: 210000,
+		SaltLen:    16,
+		KeyLen:     64,
+		Digest:     SHA512,
+	}
+
+	// MinParams are the weakest parameters accepted at registration. The
+	// Digest is not considered.
+	MinParams = Params{
+		Iterations: 100000,
+		SaltLen:    16,
+		KeyLen:     16,
+	}
+)
+
+// MaxIterations is the most iterations that verifying a stored challenge may
+// use, and MaxKeyLen the longest key, as each block of key takes another
+// round of iterations. Challenges exceeding either are treated as corrupt
+// rather than tying up a CPU.
+var (
+	MaxIterations = 10000000
+	MaxKeyLen     = 128
+)
+
+var digests = map[string]func() hash.Hash{
+	SHA256: sha256.New,
+	SHA512: sha512.New,
+}
+
+func init() {
+	auth.Register(PBKDF2SHA256Default, New(DefaultSHA256Params))
+	auth.Register(PBKDF2SHA512Default, New(DefaultSHA512Params))
+}
+
+// Params holds the PBKDF2 cost parameters, output sizes, and HMAC digest.
+type Params struct {
+	Iterations int    // Number of HMAC iterations
+	SaltLen    int    // Length of the random salt in bytes
+	KeyLen     int    // Length of the derived key in bytes
+	Digest     string // HMAC digest, SHA256 or SHA512
+}
+
+// PBKDF2 computes challenges as PHC strings of the form
+// $pbkdf2-<Digest>$i=<Iterations>$<salt>$<key>. Verification uses the
+// parameters stored in the challenge.
+type PBKDF2 struct {
+	params Params
+}
+
+// New creates a PBKDF2 with the given parameters. The parameters are
+// validated when the PBKDF2 is registered with auth.Register.
+func New(p Params) *PBKDF2 {
+	return &PBKDF2{params: p}
+}
+
+// Params returns the parameters used to compute new challenges.
+func (k PBKDF2) Params() Params {
+	return k.params
+}
+
+func (k PBKDF2) Compute(v []byte) ([]byte, error) {
+	return k.ComputeContext(context.Background(), v)
+}
+
+// ComputeContext is like Compute but gives up with ctx.Err() if ctx is done
+// before the key is derived.
+func (k PBKDF2) ComputeContext(ctx context.Context, v []byte) ([]byte, error) {
+	p := k.params
+	h, ok := digests[p.Digest]
+	if !ok {
+		return nil, errors.New("unsupported pbkdf2 digest " + p.Digest)
+	}
+	salt := make([]byte, p.SaltLen)
+	n, err := rand.Read(salt)
+	if n != p.SaltLen {
+		return nil, errors.New("wrong number of salt bytes read")
+	}
+	if err != nil {
+		return nil, err
+	}
+	d, err := key(ctx, v, salt, p.Iterations, p.KeyLen, h)
+	if err != nil {
+		return nil, err
+	}
+	c := &phc.Hash{
+		ID:     phcPrefix + p.Digest,
+		Params: []phc.Param{phc.IntParam("i", p.Iterations)},
+		Salt:   salt,
+		Hash:   d,
+	}
+	return c.Bytes(), nil
+}
+
+func (k PBKDF2) Verify(challenge, attempt []byte) (bool, error) {
+	return k.VerifyContext(context.Background(), challenge, attempt)
+}
+
+// VerifyContext is like Verify but gives up with ctx.Err() if ctx is done
+// before the key is derived.
+func (k PBKDF2) VerifyContext(ctx context.Context, challenge, attempt []byte) (bool, error) {
+	p, salt, want, err := decode(challenge)
+	if err != nil {
+		return false, &auth.CorruptError{Str: err.Error()}
+	}
+	d, err := key(ctx, attempt, salt, p.Iterations, p.KeyLen, digests[p.Digest])
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(d, want) == 1, nil
+}
+
+// NeedsRehash reports whether the challenge was computed with weaker
+// parameters or a different digest than k.
+func (k PBKDF2) NeedsRehash(challenge []byte) bool {
+	p, _, _, err := decode(challenge)
+	if err != nil {
+		return true
+	}
+	return p.Digest != k.params.Digest || p.weakerThan(k.params)
+}
+
+// Validate rejects unsupported digests, parameters weaker than MinParams, and
+// parameters whose challenges couldn't be verified because they exceed
+// MaxIterations or MaxKeyLen.
+func (k PBKDF2) Validate() error {
+	if _, ok := digests[k.params.Digest]; !ok {
+		return errors.New("unsupported pbkdf2 digest " + k.params.Digest)
+	}
+	if k.params.weakerThan(MinParams) {
+		return errors.New("pbkdf2 parameters weaker than minimum")
+	}
+	if k.params.Iterations > MaxIterations || k.params.KeyLen > MaxKeyLen {
+		return errors.New("pbkdf2 parameters exceed maximum")
+	}
+	return nil
+}
+
+func (p Params) weakerThan(o Params) bool {
+	return p.Iterations < o.Iterations || p.SaltLen < o.SaltLen || p.KeyLen < o.KeyLen
+}
+
+// decode extracts the parameters, salt, and key from a stored challenge.
+func decode(challenge []byte) (Params, []byte, []byte, error) {
+	h, err := phc.Parse(challenge)
+	if err != nil {
+		return Params{}, nil, nil, err
+	}
+	if !strings.HasPrefix(h.ID, phcPrefix) {
+		return Params{}, nil, nil, errors.New("not a pbkdf2 challenge")
+	}
+	digest := strings.TrimPrefix(h.ID, phcPrefix)
+	if _, ok := digests[digest]; !ok {
+		return Params{}, nil, nil, errors.New("unsupported pbkdf2 digest " + digest)
+	}
+	if len(h.Salt) == 0 || len(h.Hash) == 0 {
+		return Params{}, nil, nil, errors.New("pbkdf2 challenge missing salt or key")
+	}
+	if len(h.Hash) < MinParams.KeyLen || len(h.Hash) > MaxKeyLen {
+		return Params{}, nil, nil, errors.New("pbkdf2 key length out of range")
+	}
+	i, err := h.Int("i")
+	if err != nil {
+		return Params{}, nil, nil, err
+	}
+	if i < 1 || i > MaxIterations {
+		return Params{}, nil, nil, errors.New("pbkdf2 iterations out of range")
+	}
+	return Params{
+		Iterations: int(i),
+		SaltLen:    len(h.Salt),
+		KeyLen:     len(h.Hash),
+		Digest:     digest,
+	}, h.Salt, h.Hash, nil
+}
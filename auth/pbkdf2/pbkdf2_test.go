@@ -0,0 +1,111 @@
+package pbkdf2
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AgentZombie/dontusepasswords/auth"
+	"github.com/AgentZombie/dontusepasswords/auth/authtest"
+)
+
+// Keys from Python's hashlib.pbkdf2_hmac.
+var vectors = []string{
+	"$pbkdf2-sha256$i=1000$c2FsdHNhbHRzYWx0c2FsdA$8nX7hwFEzIB8aPajJTYK8weHQc5Ngz0pFVAKvSu4jQA",
+	"$pbkdf2-sha512$i=1000$c2FsdHNhbHRzYWx0c2FsdA$715rqIr5dXOVPpBhqqsugl037zT5bWJTWYmZtIcK8hBnisKpwfY7kokvwjDrNHqHhF50Pb7MD6HvkJwiDQw4ww",
+}
+
+func TestVectors(t *testing.T) {
+	for _, v := range vectors {
+		// Stored parameters are used regardless of the profile.
+		if ok, _ := auth.Verify(PBKDF2SHA256Default, []byte(v), []byte("password")); !ok {
+			t.Fatalf("%s: expected password to verify", v)
+		}
+		if ok, _ := auth.Verify(PBKDF2SHA256Default, []byte(v), []byte("passwore")); ok {
+			t.Fatalf("%s: expected wrong password not to verify", v)
+		}
+		if rehash, _ := auth.NeedsRehash(PBKDF2SHA256Default, []byte(v)); !rehash {
+			t.Fatalf("%s: expected rehash of weak challenge", v)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	for _, p := range []Params{DefaultSHA256Params, DefaultSHA512Params} {
+		var vs []authtest.Vector
+		for _, v := range vectors {
+			if strings.HasPrefix(v, phcPrefix+p.Digest+"$") {
+				vs = append(vs, authtest.Vector{Challenge: []byte(v), Value: []byte("password")})
+			}
+		}
+		t.Run(p.Digest, func(t *testing.T) {
+			authtest.Run(t, New(p), authtest.Options{Vectors: vs})
+		})
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	for _, authtype := range []string{PBKDF2SHA256Default, PBKDF2SHA512Default} {
+		c, err := auth.Compute(authtype, []byte("password"))
+		if err != nil {
+			t.Fatalf("%s: unexpected error computing: %q", authtype, err)
+		}
+		if ok, _ := auth.Verify(authtype, c, []byte("password")); !ok {
+			t.Fatalf("%s: expected password to verify", authtype)
+		}
+		if rehash, _ := auth.NeedsRehash(authtype, c); rehash {
+			t.Fatalf("%s: expected no rehash with current parameters", authtype)
+		}
+	}
+	c, _ := auth.Compute(PBKDF2SHA512Default, []byte("password"))
+	if rehash, _ := auth.NeedsRehash(PBKDF2SHA256Default, c); !rehash {
+		t.Fatal("expected rehash when digest changes")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	weak := DefaultSHA256Params
+	weak.Iterations = 1000
+	if err := auth.Register("PBKDF2WEAK", New(weak)); err == nil {
+		t.Fatal("expected error registering weak parameters, got none")
+	}
+	heavy := DefaultSHA256Params
+	heavy.Iterations = MaxIterations + 1
+	if err := auth.Register("PBKDF2TOOHEAVY", New(heavy)); err == nil {
+		t.Fatal("expected error registering parameters over the maximum, got none")
+	}
+	md5 := DefaultSHA256Params
+	md5.Digest = "md5"
+	if err := auth.Register("PBKDF2MD5", New(md5)); err == nil {
+		t.Fatal("expected error registering unsupported digest, got none")
+	}
+}
+
+func TestOutOfRange(t *testing.T) {
+	for _, c := range []string{
+		"$pbkdf2-sha256$i=2147483647$c2FsdHNhbHRzYWx0c2FsdA$8nX7hwFEzIB8aPajJTYK8weHQc5Ngz0pFVAKvSu4jQA",
+		"$pbkdf2-sha256$i=1000$c2FsdHNhbHRzYWx0c2FsdA$" + strings.Repeat("A", 4*(MaxKeyLen+3)/3),
+	} {
+		start := time.Now()
+		if _, err := auth.Verify(PBKDF2SHA256Default, []byte(c), []byte("password")); !auth.IsCorrupt(err) {
+			t.Fatalf("%s: expected corrupt error, got %v", c, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("%s: expected out of range challenge to be rejected promptly, took %s", c, d)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := New(Params{Iterations: 1 << 30, SaltLen: 16, KeyLen: 32, Digest: SHA256})
+	start := time.Now()
+	if _, err := p.ComputeContext(ctx, []byte("password")); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expected cancellation to stop computation promptly, took %s", d)
+	}
+}
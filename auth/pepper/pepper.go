@@ -0,0 +1,249 @@
+// package pepper wraps registered auth types with a secret, server-side key
+// so that a leaked account store can't be attacked offline without also
+// obtaining the key. Values are HMAC-SHA256'd with the key before being
+// passed to the wrapped auth type, and the key's ID is stored in the
+// challenge:
+//
+//	$pepper$k=<key id>$<wrapped challenge>
+//
+// Keys are rotated with Keyring.Add and Keyring.SetCurrent, which are safe
+// while the Keyring is in use. Challenges made with older keys still verify
+// as long as those keys remain in the Keyring, and are recomputed with the
+// current key at the next login.
+//
+// Keys must be kept out of the account store, e.g. in the environment or a
+// secrets manager. Because they aren't available at init time, peppered
+// profiles are registered explicitly:
+//
+//	pepper.RegisterDefaults(&pepper.Keyring{Current: "2024", Keys: keys})
+package pepper
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/auth"
+	"github.com/AgentZombie/dontusepasswords/auth/argon2"
+	"github.com/AgentZombie/dontusepasswords/auth/bcrypt"
+	"github.com/AgentZombie/dontusepasswords/auth/scrypt"
+)
+
+const (
+	BcryptDefault   = "PEPPERBCRYPTDEFAULT"   // Peppered default-strength bcrypt
+	ScryptDefault   = "PEPPERSCRYPTDEFAULT"   // Peppered default-strength scrypt
+	Argon2idDefault = "PEPPERARGON2IDDEFAULT" // Peppered default-strength Argon2id
+
+	MinKeyLen = 32 // The shortest key accepted at registration
+
+	prefix = "$pepper$k="
+)
+
+// Keyring holds pepper keys by ID. Current and Keys are set when the Keyring
+// is created; once it is in use, change it only through its methods.
+type Keyring struct {
+	Current string            // The ID of the key used for new challenges
+	Keys    map[string][]byte // Every key that challenges may have been made with, by ID
+
+	lock sync.RWMutex
+}
+
+// Add adds a key to the Keyring, replacing any key with the same ID. It
+// doesn't make the key current; challenges made once another instance has
+// been given the key can then verify here before it becomes current.
+func (k *Keyring) Add(id string, key []byte) error {
+	if !validID(id) {
+		return errors.New("invalid pepper key id " + id)
+	}
+	if len(key) < MinKeyLen {
+		return errors.New("pepper key " + id + " too short")
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.Keys == nil {
+		k.Keys = map[string][]byte{}
+	}
+	k.Keys[id] = append([]byte(nil), key...)
+	return nil
+}
+
+// SetCurrent makes a key already in the Keyring the one used for new
+// challenges.
+func (k *Keyring) SetCurrent(id string) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if _, ok := k.Keys[id]; !ok {
+		return errors.New("pepper key " + id + " missing")
+	}
+	k.Current = id
+	return nil
+}
+
+// Remove removes a key from the Keyring. Challenges made with it no longer
+// verify. The current key can't be removed.
+func (k *Keyring) Remove(id string) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if id == k.Current {
+		return errors.New("can't remove current pepper key " + id)
+	}
+	delete(k.Keys, id)
+	return nil
+}
+
+// current returns the current key and its ID.
+func (k *Keyring) current() (string, []byte, bool) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	key, ok := k.Keys[k.Current]
+	return k.Current, key, ok
+}
+
+// key returns the key with the given ID.
+func (k *Keyring) key(id string) ([]byte, bool) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	key, ok := k.Keys[id]
+	return key, ok
+}
+
+// Pepper computes and verifies challenges of a wrapped auth type using
+// peppered values.
+type Pepper struct {
+	inner string
+	keys  *Keyring
+}
+
+// New creates a Pepper wrapping the named auth type. The keys are validated
+// when the Pepper is registered with auth.Register.
+func New(inner string, keys *Keyring) *Pepper {
+	return &Pepper{inner: inner, keys: keys}
+}
+
+// RegisterDefaults registers peppered variants of the default profiles of
+// the included auth modules.
+func RegisterDefaults(keys *Keyring) error {
+	for name, inner := range map[string]string{
+		BcryptDefault:   bcrypt.BcryptDefault,
+		ScryptDefault:   scrypt.ScryptDefault,
+		Argon2idDefault: argon2.Argon2idDefault,
+	} {
+		if err := auth.Register(name, New(inner, keys)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Pepper) Compute(v []byte) ([]byte, error) {
+	return p.ComputeContext(context.Background(), v)
+}
+
+// ComputeContext is like Compute but passes ctx on to the wrapped auth type.
+func (p *Pepper) ComputeContext(ctx context.Context, v []byte) ([]byte, error) {
+	id, key, ok := p.keys.current()
+	if !ok {
+		return nil, errors.New("current pepper key missing")
+	}
+	c, err := auth.ComputeContext(ctx, p.inner, mac(key, v))
+	if err != nil {
+		return nil, err
+	}
+	out := []byte(prefix + id + "$")
+	return append(out, c...), nil
+}
+
+func (p *Pepper) Verify(challenge, attempt []byte) (bool, error) {
+	return p.VerifyContext(context.Background(), challenge, attempt)
+}
+
+// VerifyContext is like Verify but passes ctx on to the wrapped auth type.
+func (p *Pepper) VerifyContext(ctx context.Context, challenge, attempt []byte) (bool, error) {
+	id, inner, err := decode(challenge)
+	if err != nil {
+		return false, &auth.CorruptError{Str: err.Error()}
+	}
+	key, ok := p.keys.key(id)
+	if !ok {
+		return false, errors.New("pepper key " + id + " missing")
+	}
+	return auth.VerifyContext(ctx, p.inner, inner, mac(key, attempt))
+}
+
+// NeedsRehash reports whether the challenge was made with a key other than
+// the current one or needs to be recomputed by the wrapped auth type.
+func (p *Pepper) NeedsRehash(challenge []byte) bool {
+	id, inner, err := decode(challenge)
+	if current, _, _ := p.keys.current(); err != nil || id != current {
+		return true
+	}
+	rehash, err := auth.NeedsRehash(p.inner, inner)
+	return err != nil || rehash
+}
+
+// Validate requires the current key to be present and every key to be at
+// least MinKeyLen bytes.
+func (p *Pepper) Validate() error {
+	if p.keys == nil {
+		return errors.New("no pepper keys")
+	}
+	p.keys.lock.RLock()
+	defer p.keys.lock.RUnlock()
+	if _, ok := p.keys.Keys[p.keys.Current]; !ok {
+		return errors.New("current pepper key missing")
+	}
+	for id, k := range p.keys.Keys {
+		if !validID(id) {
+			return errors.New("invalid pepper key id " + id)
+		}
+		if len(k) < MinKeyLen {
+			return errors.New("pepper key " + id + " too short")
+		}
+	}
+	return nil
+}
+
+// mac returns the base64 encoded HMAC of v, which avoids NUL bytes and
+// length limits in wrapped algorithms such as bcrypt.
+func mac(key, v []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(v)
+	sum := h.Sum(nil)
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(sum)))
+	base64.StdEncoding.Encode(out, sum)
+	return out
+}
+
+// decode splits a challenge into its key ID and wrapped challenge.
+func decode(challenge []byte) (string, []byte, error) {
+	if !bytes.HasPrefix(challenge, []byte(prefix)) {
+		return "", nil, errors.New("not a pepper challenge")
+	}
+	rest := challenge[len(prefix):]
+	i := bytes.IndexByte(rest, '$')
+	if i < 0 {
+		return "", nil, errors.New("malformed pepper challenge")
+	}
+	id := string(rest[:i])
+	if !validID(id) {
+		return "", nil, errors.New("invalid pepper key id")
+	}
+	return id, rest[i+1:], nil
+}
+
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
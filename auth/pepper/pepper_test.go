@@ -0,0 +1,150 @@
+package pepper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/AgentZombie/dontusepasswords/auth"
+	"github.com/AgentZombie/dontusepasswords/auth/authtest"
+	"github.com/AgentZombie/dontusepasswords/auth/bcrypt"
+	"github.com/AgentZombie/dontusepasswords/auth/pbkdf2"
+)
+
+func TestRotation(t *testing.T) {
+	keys := &Keyring{
+		Current: "one",
+		Keys:    map[string][]byte{"one": bytes.Repeat([]byte{1}, 32)},
+	}
+	p := New(bcrypt.BcryptDefault, keys)
+	if err := auth.Register("PEPPERTEST", p); err != nil {
+		t.Fatalf("unexpected error registering: %q", err)
+	}
+	c, err := auth.Compute("PEPPERTEST", []byte("password"))
+	if err != nil {
+		t.Fatalf("unexpected error computing: %q", err)
+	}
+	if ok, _ := auth.Verify("PEPPERTEST", c, []byte("password")); !ok {
+		t.Fatal("expected password to verify")
+	}
+	if ok, _ := auth.Verify("PEPPERTEST", c, []byte("wrong")); ok {
+		t.Fatal("expected wrong password not to verify")
+	}
+	// Without the key, the wrapped challenge doesn't verify the password.
+	_, inner, _ := decode(c)
+	if ok, _ := auth.Verify(bcrypt.BcryptDefault, inner, []byte("password")); ok {
+		t.Fatal("expected unpeppered password not to verify")
+	}
+	if rehash, _ := auth.NeedsRehash("PEPPERTEST", c); rehash {
+		t.Fatal("expected no rehash with current key")
+	}
+
+	if err := keys.Add("two", bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatalf("unexpected error adding key: %q", err)
+	}
+	if err := keys.SetCurrent("two"); err != nil {
+		t.Fatalf("unexpected error rotating key: %q", err)
+	}
+	if ok, _ := auth.Verify("PEPPERTEST", c, []byte("password")); !ok {
+		t.Fatal("expected password to verify with old key")
+	}
+	if rehash, _ := auth.NeedsRehash("PEPPERTEST", c); !rehash {
+		t.Fatal("expected rehash after rotation")
+	}
+
+	if err := keys.Remove("two"); err == nil {
+		t.Fatal("expected error removing current key, got none")
+	}
+	if err := keys.Remove("one"); err != nil {
+		t.Fatalf("unexpected error removing key: %q", err)
+	}
+	if ok, _ := auth.Verify("PEPPERTEST", c, []byte("password")); ok {
+		t.Fatal("expected password not to verify after its key is removed")
+	}
+}
+
+// plain is a cheap auth type to wrap where the wrapped hashing doesn't matter.
+type plain struct{}
+
+func (plain) Compute(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (plain) Verify(challenge, attempt []byte) (bool, error) {
+	return bytes.Equal(challenge, attempt), nil
+}
+
+func TestConcurrentRotation(t *testing.T) {
+	keys := &Keyring{
+		Current: "one",
+		Keys:    map[string][]byte{"one": bytes.Repeat([]byte{1}, 32)},
+	}
+	if err := auth.Register("PEPPERROTATEINNER", plain{}); err != nil {
+		t.Fatalf("unexpected error registering: %q", err)
+	}
+	p := New("PEPPERROTATEINNER", keys)
+	if err := auth.Register("PEPPERROTATETEST", p); err != nil {
+		t.Fatalf("unexpected error registering: %q", err)
+	}
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for j := 0; j < 20; j++ {
+				c, err := auth.Compute("PEPPERROTATETEST", []byte("password"))
+				if err != nil {
+					done <- err
+					return
+				}
+				auth.NeedsRehash("PEPPERROTATETEST", c)
+			}
+			done <- nil
+		}()
+	}
+	for _, id := range []string{"two", "three", "four"} {
+		if err := keys.Add(id, bytes.Repeat([]byte(id[:1]), 32)); err != nil {
+			t.Fatalf("unexpected error adding key: %q", err)
+		}
+		if err := keys.SetCurrent(id); err != nil {
+			t.Fatalf("unexpected error rotating key: %q", err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error computing during rotation: %q", err)
+		}
+	}
+	if err := keys.SetCurrent("missing"); err == nil {
+		t.Fatal("expected error making missing key current, got none")
+	}
+	if err := keys.Add("short", []byte("short")); err == nil {
+		t.Fatal("expected error adding short key, got none")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, k := range []*Keyring{
+		nil,
+		{Current: "missing", Keys: map[string][]byte{}},
+		{Current: "short", Keys: map[string][]byte{"short": []byte("short")}},
+		{Current: "bad$id", Keys: map[string][]byte{"bad$id": bytes.Repeat([]byte{1}, 32)}},
+	} {
+		if err := New(bcrypt.BcryptDefault, k).Validate(); err == nil {
+			t.Fatalf("expected validation error for %+v", k)
+		}
+	}
+}
+
+// Computed with Python's hmac and hashlib.pbkdf2_hmac.
+var vectors = []authtest.Vector{
+	{
+		Challenge: []byte("$pepper$k=one$$pbkdf2-sha256$i=1000$c2FsdHNhbHRzYWx0c2FsdA$27Hgu1crlVW9JMdWbS6C+rclQ4DjBWLicv3pwFLXNqM"),
+		Value:     []byte("password"),
+	},
+}
+
+func TestConformance(t *testing.T) {
+	keys := &Keyring{
+		Current: "one",
+		Keys:    map[string][]byte{"one": bytes.Repeat([]byte{1}, 32)},
+	}
+	authtest.Run(t, New(pbkdf2.PBKDF2SHA256Default, keys), authtest.Options{Vectors: vectors})
+}
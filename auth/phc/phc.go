@@ -0,0 +1,151 @@
+// package phc encodes and decodes authentication challenges in the PHC
+// string format, which records the algorithm and its parameters alongside
+// the salt and hash:
+//
+//	$<id>[$v=<version>][$<param>=<value>(,<param>=<value>)*][$<salt>[$<hash>]]
+//
+// Salt and hash are encoded with unpadded standard base64.
+package phc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// b64 rejects nonzero padding bits so that each hash has only one encoding.
+var b64 = base64.RawStdEncoding.Strict()
+
+// Param is a single named parameter of a PHC string.
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Hash is the decoded form of a PHC string.
+type Hash struct {
+	ID      string  // The algorithm identifier, e.g. "scrypt"
+	Version int     // The algorithm version, or 0 if not present
+	Params  []Param // Algorithm parameters in encoding order
+	Salt    []byte
+	Hash    []byte
+}
+
+// Parse decodes a PHC string.
+func Parse(b []byte) (*Hash, error) {
+	if len(b) == 0 || b[0] != '$' {
+		return nil, errors.New("not a PHC string")
+	}
+	fields := strings.Split(string(b[1:]), "$")
+	h := &Hash{ID: fields[0]}
+	if !validID(h.ID) {
+		return nil, errors.New("invalid PHC algorithm identifier")
+	}
+	fields = fields[1:]
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "v=") {
+		v, err := strconv.Atoi(fields[0][2:])
+		if err != nil || v <= 0 {
+			return nil, errors.New("invalid PHC version")
+		}
+		h.Version = v
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && strings.Contains(fields[0], "=") {
+		for _, kv := range strings.Split(fields[0], ",") {
+			i := strings.IndexByte(kv, '=')
+			if i < 1 {
+				return nil, errors.New("invalid PHC parameter")
+			}
+			h.Params = append(h.Params, Param{Name: kv[:i], Value: kv[i+1:]})
+		}
+		fields = fields[1:]
+	}
+	if len(fields) > 2 {
+		return nil, errors.New("trailing data in PHC string")
+	}
+	var err error
+	if len(fields) > 0 {
+		if h.Salt, err = b64.DecodeString(fields[0]); err != nil {
+			return nil, errors.Wrap(err, "decoding PHC salt")
+		}
+	}
+	if len(fields) > 1 {
+		if h.Hash, err = b64.DecodeString(fields[1]); err != nil {
+			return nil, errors.Wrap(err, "decoding PHC hash")
+		}
+	}
+	return h, nil
+}
+
+// Bytes encodes h as a PHC string.
+func (h *Hash) Bytes() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("$" + h.ID)
+	if h.Version > 0 {
+		buf.WriteString("$v=" + strconv.Itoa(h.Version))
+	}
+	for i, p := range h.Params {
+		if i == 0 {
+			buf.WriteByte('$')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(p.Name + "=" + p.Value)
+	}
+	if h.Salt != nil {
+		buf.WriteString("$" + b64.EncodeToString(h.Salt))
+		if h.Hash != nil {
+			buf.WriteString("$" + b64.EncodeToString(h.Hash))
+		}
+	}
+	return buf.Bytes()
+}
+
+// String returns the PHC string representation of h.
+func (h *Hash) String() string {
+	return string(h.Bytes())
+}
+
+// Param returns the value of the named parameter and whether it was present.
+func (h *Hash) Param(name string) (string, bool) {
+	for _, p := range h.Params {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// Int returns the value of the named parameter as a non-negative integer.
+// It is an error for the parameter to be missing or malformed.
+func (h *Hash) Int(name string) (int, error) {
+	v, ok := h.Param(name)
+	if !ok {
+		return 0, errors.New("missing PHC parameter " + name)
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return 0, errors.New("invalid PHC parameter " + name)
+	}
+	return i, nil
+}
+
+// IntParam returns a Param holding an integer value.
+func IntParam(name string, v int) Param {
+	return Param{Name: name, Value: strconv.Itoa(v)}
+}
+
+func validID(id string) bool {
+	if len(id) == 0 || len(id) > 32 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package phc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"$scrypt$ln=14,r=8,p=1$c2FsdA$a2V5",
+		"$pbkdf2-sha256",
+	} {
+		h, err := Parse([]byte(s))
+		if err != nil {
+			t.Fatalf("unexpected error parsing %q: %q", s, err)
+		}
+		if got := h.String(); got != s {
+			t.Fatalf("expected %q, got %q", s, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	h, err := Parse([]byte("$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"))
+	if err != nil {
+		t.Fatalf("unexpected error: %q", err)
+	}
+	if h.ID != "argon2id" || h.Version != 19 {
+		t.Fatalf("unexpected id/version %q/%d", h.ID, h.Version)
+	}
+	if m, err := h.Int("m"); err != nil || m != 65536 {
+		t.Fatalf("expected m=65536, got %d (%v)", m, err)
+	}
+	if _, err := h.Int("x"); err == nil {
+		t.Fatal("expected error for missing parameter, got none")
+	}
+	if !bytes.Equal(h.Salt, []byte("somesalt")) {
+		t.Fatalf("unexpected salt %q", h.Salt)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"scrypt$ln=14",
+		"$$",
+		"$SCRYPT$ln=14",
+		"$scrypt$v=x",
+		"$scrypt$ln=14,r$c2FsdA",
+		"$scrypt$ln=14$c2FsdA$a2V5$extra",
+		"$scrypt$ln=14$!!!$a2V5",
+		"$scrypt$ln=14$c2FsdA$a2V", // nonzero padding bits
+	} {
+		if _, err := Parse([]byte(s)); err == nil {
+			t.Fatalf("expected error parsing %q, got none", s)
+		}
+	}
+}
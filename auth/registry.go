@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Info describes a registered auth type.
+type Info struct {
+	Name       string   // The name the auth type was registered under
+	Aliases    []string // Other names that refer to the auth type
+	Deprecated bool     // Whether the auth type is deprecated
+	Limits     *Limits  // Limits set for the auth type, if any
+}
+
+// List returns the names of all registered auth types, sorted. Aliases are
+// not included; see Info.
+func List() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the ComputerVerifier registered under name, which may be an
+// alias.
+func Lookup(name string) (ComputerVerifier, bool) {
+	e, ok := lookup(name)
+	return e.cv, ok
+}
+
+// Describe returns details of the auth type registered under name, which may
+// be an alias.
+func Describe(name string) (*Info, error) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	canonical := resolve(name)
+	e, ok := registry[canonical]
+	if !ok {
+		return nil, &invalidAuthType{name}
+	}
+	i := &Info{Name: canonical, Deprecated: e.deprecated}
+	for alias, target := range aliases {
+		if target == canonical {
+			i.Aliases = append(i.Aliases, alias)
+		}
+	}
+	sort.Strings(i.Aliases)
+	if e.gov != nil {
+		l := e.gov.limits
+		i.Limits = &l
+	}
+	return i, nil
+}
+
+// Alias registers another name for an already registered auth type, e.g. so
+// that challenges stored under a profile's old name still verify after it's
+// renamed. The alias must not already be in use.
+func Alias(alias, name string) error {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	canonical := resolve(name)
+	if _, ok := registry[canonical]; !ok {
+		return &invalidAuthType{name}
+	}
+	if taken(alias) {
+		return errors.New("duplicate ComputerVerifier: " + alias)
+	}
+	aliases[alias] = canonical
+	return nil
+}
+
+// Canonical returns the name an auth type was registered under, resolving
+// aliases. Names that aren't aliases are returned unchanged, whether or not
+// they are registered.
+func Canonical(name string) string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return resolve(name)
+}
+
+// Deprecate marks a registered auth type as deprecated. Deprecated auth types
+// still compute and verify challenges so existing accounts can log in, at
+// which point Accounts.Auth replaces them with the configured auth type.
+// Accounts.Report flags accounts still using them. Configuring a deprecated
+// auth type as Accounts.AuthType is an error.
+func Deprecate(name string) error {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	e, ok := registry[resolve(name)]
+	if !ok {
+		return &invalidAuthType{name}
+	}
+	e.deprecated = true
+	return nil
+}
+
+// IsDeprecated reports whether an auth type, or the auth type an alias refers
+// to, is deprecated.
+func IsDeprecated(name string) bool {
+	e, ok := lookup(name)
+	return ok && e.deprecated
+}
+
+// lookup returns a copy of the registry entry for name, resolving aliases.
+func lookup(name string) (entry, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	e, ok := registry[resolve(name)]
+	if !ok {
+		return entry{}, false
+	}
+	return *e, true
+}
+
+// resolve returns the canonical name for name. The lock must be held.
+func resolve(name string) string {
+	if canonical, ok := aliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// taken reports whether name is registered as an auth type or alias. The
+// lock must be held.
+func taken(name string) bool {
+	_, registered := registry[name]
+	_, aliased := aliases[name]
+	return registered || aliased
+}
@@ -1,57 +1,224 @@
+// package scrypt implements the scrypt algorithm as an authentication
+// method. Normally this package is imported only for side-effects:
+//
+//	import _ "dontusepasswords/auth/scrypt"
+//
+// Additional profiles can be registered under application-chosen names:
+//
+//	auth.Register("SCRYPTHEAVY", scrypt.New(scrypt.Params{N: 1 << 17, R: 8, P: 1, KeyLen: 32, SaltLen: 32}))
 package scrypt
 
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/subtle"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/scrypt"
 
 	"github.com/AgentZombie/dontusepasswords/auth"
+	"github.com/AgentZombie/dontusepasswords/auth/phc"
 )
 
 const (
 	ScryptDefault = "SCRYPTDEFAULT" // Default-strength scrypt
+
+	phcID = "scrypt"
+)
+
+var (
+	// DefaultParams are the parameters of the ScryptDefault profile.
+	DefaultParams = Params{
+		N:       16384,
+		R:       8,
+		P:       1,
+		KeyLen:  32,
+		SaltLen: 32,
+	}
+
+	// MinParams are the weakest parameters accepted at registration.
+	MinParams = Params{
+		N:       16384,
+		R:       8,
+		P:       1,
+		KeyLen:  16,
+		SaltLen: 16,
+	}
+
+	// legacy holds the parameters used for challenges stored as raw salt
+	// and key before challenges were encoded as PHC strings.
+	legacy = DefaultParams
 )
 
+// MaxMemory is the most memory, in bytes, that verifying a stored challenge
+// may use. Challenges requiring more are treated as corrupt rather than
+// risking exhausting memory.
+var MaxMemory uint64 = 1 << 30
+
 func init() {
-	auth.Register(ScryptDefault, &Scrypt{
-		len:     32,
-		saltLen: 32,
-		n:       16384,
-		r:       8,
-		p:       1,
-	})
+	auth.Register(ScryptDefault, New(DefaultParams))
+}
+
+// Params holds the scrypt cost parameters and output sizes.
+type Params struct {
+	N       int // CPU/memory cost, a power of two
+	R       int // Block size
+	P       int // Parallelization
+	KeyLen  int // Length of the derived key in bytes
+	SaltLen int // Length of the random salt in bytes
 }
 
+// Scrypt computes challenges as PHC strings of the form
+// $scrypt$ln=<log2(N)>,r=<R>,p=<P>$<salt>$<key>. Verification uses the
+// parameters stored in the challenge.
 type Scrypt struct {
-	len     int
-	saltLen int
-	n       int
-	r       int
-	p       int
+	params Params
+}
+
+// New creates a Scrypt with the given parameters. The parameters are
+// validated when the Scrypt is registered with auth.Register.
+func New(p Params) *Scrypt {
+	return &Scrypt{params: p}
+}
+
+// Params returns the parameters used to compute new challenges.
+func (s Scrypt) Params() Params {
+	return s.params
 }
 
 func (s Scrypt) Compute(v []byte) ([]byte, error) {
-	salt := make([]byte, s.saltLen)
+	p := s.params
+	salt := make([]byte, p.SaltLen)
 	n, err := rand.Read(salt)
-	if n != s.saltLen {
+	if n != p.SaltLen {
 		return nil, errors.New("wrong number of salt bytes read")
 	}
 	if err != nil {
 		return nil, err
 	}
-	k, err := scrypt.Key(v, salt, s.n, s.r, s.p, s.len)
+	k, err := scrypt.Key(v, salt, p.N, p.R, p.P, p.KeyLen)
 	if err != nil {
 		return nil, err
 	}
-	return append(salt, k...), nil
+	h := &phc.Hash{
+		ID: phcID,
+		Params: []phc.Param{
+			phc.IntParam("ln", log2(p.N)),
+			phc.IntParam("r", p.R),
+			phc.IntParam("p", p.P),
+		},
+		Salt: salt,
+		Hash: k,
+	}
+	return h.Bytes(), nil
+}
+
+func (s Scrypt) Verify(challenge, attempt []byte) (bool, error) {
+	p, salt, key, err := decode(challenge)
+	if err != nil {
+		return false, &auth.CorruptError{Str: err.Error()}
+	}
+	k, err := scrypt.Key(attempt, salt, p.N, p.R, p.P, len(key))
+	if err != nil {
+		return false, &auth.CorruptError{Str: err.Error()}
+	}
+	return subtle.ConstantTimeCompare(k, key) == 1, nil
 }
 
-func (s Scrypt) Verify(challenge, attempt []byte) bool {
-	k, err := scrypt.Key(attempt, challenge[:s.saltLen], s.n, s.r, s.p, s.len)
+// NeedsRehash reports whether the challenge was computed with weaker
+// parameters than s.
+func (s Scrypt) NeedsRehash(challenge []byte) bool {
+	if !isPHC(challenge) {
+		return true
+	}
+	p, _, _, err := decode(challenge)
 	if err != nil {
-		return false
+		return true
+	}
+	return p.weakerThan(s.params)
+}
+
+// MemoryCost returns the approximate memory used to compute a challenge, in
+// bytes.
+func (s Scrypt) MemoryCost() uint64 {
+	p := s.params
+	return 128*uint64(p.N)*uint64(p.R) + 128*uint64(p.R)*uint64(p.P)
+}
+
+// Validate rejects parameters weaker than MinParams or that scrypt itself
+// doesn't accept.
+func (s Scrypt) Validate() error {
+	p := s.params
+	if p.N <= 1 || p.N&(p.N-1) != 0 {
+		return errors.New("scrypt N must be a power of two greater than 1")
+	}
+	if uint64(p.R)*uint64(p.P) >= 1<<30 {
+		return errors.New("scrypt R*P too large")
+	}
+	if p.weakerThan(MinParams) {
+		return errors.New("scrypt parameters weaker than minimum")
+	}
+	return nil
+}
+
+func (p Params) weakerThan(o Params) bool {
+	return p.N < o.N || p.R < o.R || p.P < o.P || p.KeyLen < o.KeyLen || p.SaltLen < o.SaltLen
+}
+
+// decode extracts the parameters, salt, and key from a stored challenge.
+// Challenges that aren't PHC strings are treated as legacy raw salt and
+// key.
+func decode(challenge []byte) (Params, []byte, []byte, error) {
+	if !isPHC(challenge) {
+		if len(challenge) != legacy.SaltLen+legacy.KeyLen {
+			return Params{}, nil, nil, errors.New("malformed legacy scrypt challenge")
+		}
+		return legacy, challenge[:legacy.SaltLen], challenge[legacy.SaltLen:], nil
+	}
+	h, err := phc.Parse(challenge)
+	if err != nil {
+		return Params{}, nil, nil, err
+	}
+	if len(h.Salt) == 0 || len(h.Hash) == 0 {
+		return Params{}, nil, nil, errors.New("scrypt challenge missing salt or key")
+	}
+	if len(h.Hash) < MinParams.KeyLen {
+		return Params{}, nil, nil, errors.New("scrypt key shorter than minimum")
+	}
+	var p Params
+	ln, err := h.Int("ln")
+	if err != nil {
+		return Params{}, nil, nil, err
+	}
+	if ln < 1 || ln > 62 {
+		return Params{}, nil, nil, errors.New("scrypt ln out of range")
+	}
+	p.N = 1 << uint(ln)
+	if p.R, err = h.Int("r"); err != nil {
+		return Params{}, nil, nil, err
+	}
+	if p.P, err = h.Int("p"); err != nil {
+		return Params{}, nil, nil, err
+	}
+	// Check R and P alone first so MemoryCost can't overflow.
+	if p.R < 1 || p.P < 1 || ln > 40 || uint64(p.R) > MaxMemory/128/uint64(p.N) ||
+		uint64(p.P) > MaxMemory/128 || New(p).MemoryCost() > MaxMemory {
+		return Params{}, nil, nil, errors.New("scrypt parameters out of range")
+	}
+	p.SaltLen = len(h.Salt)
+	p.KeyLen = len(h.Hash)
+	return p, h.Salt, h.Hash, nil
+}
+
+func isPHC(challenge []byte) bool {
+	return bytes.HasPrefix(challenge, []byte("$"+phcID+"$"))
+}
+
+func log2(n int) int {
+	l := 0
+	for n > 1 {
+		n >>= 1
+		l++
 	}
-	return bytes.Equal(k, challenge[s.saltLen:])
+	return l
 }
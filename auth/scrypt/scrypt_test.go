@@ -0,0 +1,19 @@
+package scrypt
+
+import (
+	"testing"
+
+	"github.com/AgentZombie/dontusepasswords/auth/authtest"
+)
+
+// From RFC 7914, section 12.
+var vectors = []authtest.Vector{
+	{
+		Challenge: []byte("$scrypt$ln=10,r=8,p=16$TmFDbA$/bq+HJ00cgB4VucZDQHp/nxq18vII3gw53N2Y0s3MWIurzDZLiKjiG/xCSedmDDaxyevuUqD7m2DYMvfoswGQA"),
+		Value:     []byte("password"),
+	},
+}
+
+func TestConformance(t *testing.T) {
+	authtest.Run(t, New(DefaultParams), authtest.Options{Vectors: vectors})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/AgentZombie/dontusepasswords/account/json"
+	"github.com/AgentZombie/dontusepasswords/auth"
+	_ "github.com/AgentZombie/dontusepasswords/auth/argon2"
+	"github.com/AgentZombie/dontusepasswords/auth/bcrypt"
+	"github.com/AgentZombie/dontusepasswords/auth/legacy"
+	_ "github.com/AgentZombie/dontusepasswords/auth/scrypt"
+	"github.com/AgentZombie/dontusepasswords/auth/wrap"
+)
+
+func main() {
+	store := flag.String("store", "", "JSON account store to convert")
+	from := flag.String("from", legacy.RawMD5, "legacy auth type to wrap ("+legacy.RawMD5+" or "+legacy.RawSHA1+")")
+	outer := flag.String("outer", bcrypt.BcryptDefault, "auth type to wrap legacy hashes with")
+	to := flag.String("to", "", "auth type name for wrapped hashes, which the application must register")
+	flag.Parse()
+	if *store == "" || *to == "" {
+		log.Fatal("error: -store and -to are required")
+	}
+
+	var inner wrap.Inner
+	switch *from {
+	case legacy.RawMD5:
+		inner = legacy.MD5
+	case legacy.RawSHA1:
+		inner = legacy.SHA1
+	default:
+		log.Fatal("error: can't wrap auth type ", *from)
+	}
+	w := wrap.New(inner, *outer)
+	if err := auth.Register(*to, w); err != nil {
+		log.Fatal("error: ", err)
+	}
+
+	// Keep the unconverted store so the conversion can be undone.
+	s, err := json.Open(*store, json.Options{Backups: 1})
+	if err != nil {
+		log.Fatal("error: ", err)
+	}
+	n, err := wrap.Convert(s, *from, *to, w)
+	if err != nil {
+		log.Fatal("error: ", err)
+	}
+	log.Printf("wrapped %d accounts as %s", n, *to)
+}
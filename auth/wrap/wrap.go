@@ -0,0 +1,160 @@
+// package wrap protects weak legacy hashes without waiting for their owners
+// to log in. The stored legacy hash is itself hashed with a modern scheme,
+// so a wrapped challenge is verified by recomputing the legacy digest of the
+// attempt and verifying that against the outer challenge.
+//
+// A wrapped type is registered per legacy type and outer scheme:
+//
+//	auth.Register("WRAPMD5BCRYPT", wrap.New(legacy.MD5, bcrypt.BcryptDefault))
+//
+// and Convert rewrites every matching Account in a store. Because the
+// wrapped type is never the configured AuthType, Accounts.Auth replaces the
+// wrapped challenge with a plain modern one at the next successful login.
+package wrap
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+	"github.com/AgentZombie/dontusepasswords/auth"
+)
+
+const prefix = "$wrap$"
+
+// Inner is implemented by legacy auth types that can be wrapped.
+type Inner interface {
+	// Split separates a stored challenge into the setting needed to
+	// recompute it (salt, rounds, etc.) and the digest to be wrapped.
+	Split(challenge []byte) (setting, digest []byte, err error)
+	// Digest computes the digest of attempt with the given setting, as
+	// returned by Split.
+	Digest(setting, attempt []byte) ([]byte, error)
+}
+
+// Wrap is a ComputerVerifier for legacy challenges wrapped in an outer auth
+// type. Challenges are stored as:
+//
+//	$wrap$<base64 setting>$<outer challenge>
+type Wrap struct {
+	inner Inner
+	outer string
+}
+
+// New creates a Wrap for challenges from inner wrapped with the registered
+// auth type outer.
+func New(inner Inner, outer string) *Wrap {
+	return &Wrap{inner: inner, outer: outer}
+}
+
+// Wrap converts a legacy challenge from the inner auth type into a wrapped
+// challenge.
+func (w *Wrap) Wrap(challenge []byte) ([]byte, error) {
+	setting, digest, err := w.inner.Split(challenge)
+	if err != nil {
+		return nil, errors.Wrap(err, "splitting legacy challenge")
+	}
+	c, err := auth.Compute(w.outer, digest)
+	if err != nil {
+		return nil, errors.Wrap(err, "computing outer challenge")
+	}
+	out := make([]byte, 0, len(prefix)+base64.RawStdEncoding.EncodedLen(len(setting))+1+len(c))
+	out = append(out, prefix...)
+	out = append(out, base64.RawStdEncoding.EncodeToString(setting)...)
+	out = append(out, '$')
+	return append(out, c...), nil
+}
+
+func (w *Wrap) Verify(challenge, attempt []byte) (bool, error) {
+	return w.VerifyContext(context.Background(), challenge, attempt)
+}
+
+// VerifyContext is like Verify but passes ctx on to the outer auth type.
+func (w *Wrap) VerifyContext(ctx context.Context, challenge, attempt []byte) (bool, error) {
+	setting, outer, ok := split(challenge)
+	if !ok {
+		return false, &auth.CorruptError{Str: "malformed wrapped challenge"}
+	}
+	digest, err := w.inner.Digest(setting, attempt)
+	if err != nil {
+		return false, &auth.CorruptError{Str: err.Error()}
+	}
+	return auth.VerifyContext(ctx, w.outer, outer, digest)
+}
+
+// Compute always fails. Wrapped challenges are only made from existing
+// legacy challenges by Wrap; new challenges should use a modern auth type.
+func (w *Wrap) Compute(b []byte) ([]byte, error) {
+	return nil, errors.New("wrapped auth types are only created by Wrap")
+}
+
+// split separates a wrapped challenge into the inner setting and the outer
+// challenge.
+func split(challenge []byte) (setting, outer []byte, ok bool) {
+	if !bytes.HasPrefix(challenge, []byte(prefix)) {
+		return nil, nil, false
+	}
+	rest := challenge[len(prefix):]
+	i := bytes.IndexByte(rest, '$')
+	if i < 0 {
+		return nil, nil, false
+	}
+	setting, err := base64.RawStdEncoding.DecodeString(string(rest[:i]))
+	if err != nil {
+		return nil, nil, false
+	}
+	return setting, rest[i+1:], true
+}
+
+// Convert wraps the challenge of every Account in s with AuthType from,
+// including password history entries, and stores it with AuthType to, the
+// name w is registered under. The store must implement account.Lister.
+// Convert flushes the store and returns the number of Accounts changed.
+func Convert(s account.Store, from, to string, w *Wrap) (int, error) {
+	l, ok := s.(account.Lister)
+	if !ok {
+		return 0, errors.New("account store can't list accounts")
+	}
+	names, err := l.Names()
+	if err != nil {
+		return 0, errors.Wrap(err, "listing accounts")
+	}
+	n := 0
+	for _, name := range names {
+		a, err := s.Get(name)
+		if err != nil {
+			return n, errors.Wrap(err, "getting account "+name)
+		}
+		changed := false
+		if a.AuthType == from {
+			c, err := w.Wrap(a.AuthData)
+			if err != nil {
+				return n, errors.Wrap(err, "wrapping account "+name)
+			}
+			a.AuthType, a.AuthData = to, c
+			changed = true
+		}
+		for i, h := range a.History {
+			if h.AuthType != from {
+				continue
+			}
+			c, err := w.Wrap(h.AuthData)
+			if err != nil {
+				return n, errors.Wrap(err, "wrapping history of account "+name)
+			}
+			a.History[i] = account.Challenge{AuthType: to, AuthData: c}
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if err := s.Update(a); err != nil {
+			return n, errors.Wrap(err, "updating account "+name)
+		}
+		n++
+	}
+	return n, errors.Wrap(s.Flush(), "flushing account store")
+}
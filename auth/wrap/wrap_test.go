@@ -0,0 +1,93 @@
+package wrap
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+	"github.com/AgentZombie/dontusepasswords/account/json"
+	"github.com/AgentZombie/dontusepasswords/auth"
+	"github.com/AgentZombie/dontusepasswords/auth/authtest"
+	"github.com/AgentZombie/dontusepasswords/auth/bcrypt"
+	"github.com/AgentZombie/dontusepasswords/auth/legacy"
+	"github.com/AgentZombie/dontusepasswords/auth/pbkdf2"
+)
+
+const (
+	md5Password = "5f4dcc3b5aa765d61d8327deb882cf99" // md5("password")
+	md5Old      = "149603e6c03516362a8da23f624db945" // md5("old")
+	wrapMD5     = "WRAPMD5TEST"
+)
+
+var w = New(legacy.MD5, bcrypt.BcryptDefault)
+
+func init() {
+	auth.Register(wrapMD5, w)
+}
+
+func TestWrap(t *testing.T) {
+	c, err := w.Wrap([]byte(md5Password))
+	if err != nil {
+		t.Fatal("error wrapping: ", err)
+	}
+	if ok, err := auth.Verify(wrapMD5, c, []byte("password")); err != nil || !ok {
+		t.Fatal("expected wrapped challenge to verify: ", err)
+	}
+	if ok, _ := auth.Verify(wrapMD5, c, []byte("passwore")); ok {
+		t.Fatal("expected wrong password not to verify")
+	}
+	if ok, _ := auth.Verify(wrapMD5, c, []byte(md5Password)); ok {
+		t.Fatal("expected legacy digest not to verify as a password")
+	}
+	if _, err := w.Wrap([]byte("not a digest")); err == nil {
+		t.Fatal("expected error wrapping malformed challenge, got none")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	s, err := json.New(filepath.Join(t.TempDir(), "accounts.json"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Update(&account.Account{
+		Name:     "legacy",
+		AuthType: legacy.RawMD5,
+		AuthData: []byte(md5Password),
+		History:  []account.Challenge{{AuthType: legacy.RawMD5, AuthData: []byte(md5Old)}},
+	})
+	modern, _ := auth.Compute(bcrypt.BcryptDefault, []byte("password"))
+	s.Update(&account.Account{Name: "modern", AuthType: bcrypt.BcryptDefault, AuthData: modern})
+
+	n, err := Convert(s, legacy.RawMD5, wrapMD5, w)
+	if err != nil {
+		t.Fatal("error converting: ", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 account converted, got %d", n)
+	}
+	a, _ := s.Get("legacy")
+	if a.AuthType != wrapMD5 || a.History[0].AuthType != wrapMD5 {
+		t.Fatalf("expected account and history to be %s, got %s and %s", wrapMD5, a.AuthType, a.History[0].AuthType)
+	}
+	if ok, _ := auth.Verify(a.AuthType, a.AuthData, []byte("password")); !ok {
+		t.Fatal("expected converted account to verify")
+	}
+	if ok, _ := auth.Verify(a.History[0].AuthType, a.History[0].AuthData, []byte("old")); !ok {
+		t.Fatal("expected converted history to verify")
+	}
+	if a, _ := s.Get("modern"); a.AuthType != bcrypt.BcryptDefault {
+		t.Fatal("expected modern account to be untouched")
+	}
+}
+
+// MD5 digest wrapped with PBKDF2, computed with Python's hashlib.
+var vectors = []authtest.Vector{
+	{
+		Challenge: []byte("$wrap$$$pbkdf2-sha256$i=1000$c2FsdHNhbHRzYWx0c2FsdA$tkke4m4x0CvEFKl3/biCaL1TqRQ+J4fS7ntJ3CTy8Vg"),
+		Value:     []byte("password"),
+	},
+}
+
+func TestConformance(t *testing.T) {
+	authtest.Run(t, New(legacy.MD5, pbkdf2.PBKDF2SHA256Default), authtest.Options{Vectors: vectors, VerifyOnly: true})
+}
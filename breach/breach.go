@@ -0,0 +1,96 @@
+// package breach checks passwords against a local copy of the Have I Been
+// Pwned Pwned Passwords dataset so that passwords known from breaches can be
+// rejected without contacting an external service.
+//
+// The dataset can be used directly in its downloadable form, a text file of
+// upper-case hex SHA-1 hashes and prevalence counts sorted by hash:
+//
+//	000000005AD76BD555C1D6D771DE417A4B87E4B4:10
+//
+// or as a much smaller Bloom filter built from it with the command in
+// breach/cmd.
+package breach
+
+import (
+	"crypto/sha1"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/policy"
+)
+
+// Breached is the policy violation code for passwords found in a breach
+// corpus.
+const Breached = "breached"
+
+// Checker objects report how many times a password appears in a breach
+// corpus. A count of zero means the password wasn't found.
+type Checker interface {
+	Count(password []byte) (int, error)
+}
+
+// Rule returns a policy.Rule rejecting passwords that c reports at least
+// threshold times.
+func Rule(c Checker, threshold int) policy.Rule {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return policy.RuleFunc(func(name, password string) ([]policy.Violation, error) {
+		n, err := c.Count([]byte(password))
+		if err != nil {
+			return nil, errors.Wrap(err, "checking breached passwords")
+		}
+		if n >= threshold {
+			return []policy.Violation{{
+				Code:    Breached,
+				Message: "has appeared in a data breach and must not be used",
+				Limit:   threshold,
+			}}, nil
+		}
+		return nil, nil
+	})
+}
+
+// parseLine splits a dataset line into its hash and count. Lines without a
+// count are treated as having a count of 1.
+func parseLine(line []byte) (sum [sha1.Size]byte, count int, err error) {
+	for len(line) > 0 && (line[len(line)-1] == '\r' || line[len(line)-1] == '\n') {
+		line = line[:len(line)-1]
+	}
+	if len(line) < 2*sha1.Size {
+		return sum, 0, errors.New("short line in breach dataset")
+	}
+	for i := 0; i < sha1.Size; i++ {
+		hi, ok1 := unhex(line[2*i])
+		lo, ok2 := unhex(line[2*i+1])
+		if !ok1 || !ok2 {
+			return sum, 0, errors.New("invalid hash in breach dataset")
+		}
+		sum[i] = hi<<4 | lo
+	}
+	rest := line[2*sha1.Size:]
+	if len(rest) == 0 {
+		return sum, 1, nil
+	}
+	if rest[0] != ':' {
+		return sum, 0, errors.New("invalid separator in breach dataset")
+	}
+	count, err = strconv.Atoi(string(rest[1:]))
+	if err != nil {
+		return sum, 0, errors.New("invalid count in breach dataset")
+	}
+	return sum, count, nil
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	}
+	return 0, false
+}
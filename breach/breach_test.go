@@ -0,0 +1,160 @@
+package breach
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/AgentZombie/dontusepasswords/policy"
+)
+
+var corpus = map[string]int{
+	"password":  9545824,
+	"123456":    37359195,
+	"letmein":   2,
+	"trustno1":  1,
+	"monkey":    1000,
+	"dragon":    5,
+	"qwerty":    10000,
+	"iloveyou":  100,
+	"sunshine":  3,
+	"princess":  4,
+	"football":  7,
+	"baseball":  1,
+	"superman":  8,
+	"abc123":    9,
+	"welcome":   6,
+	"passw0rd":  11,
+	"shadow":    12,
+	"master":    13,
+	"jennifer":  14,
+	"zaq12wsx":  15,
+	"1q2w3e4r":  16,
+	"starwars":  17,
+	"whatever":  18,
+	"hunter2":   19,
+	"changeme":  20,
+	"p@ssword1": 21,
+}
+
+// writeDataset writes the corpus in the downloadable format, sorted by hash.
+func writeDataset(t *testing.T) string {
+	lines := []string{}
+	for pw, n := range corpus {
+		sum := sha1.Sum([]byte(pw))
+		lines = append(lines, fmt.Sprintf("%s:%d\r\n", strings.ToUpper(hex.EncodeToString(sum[:])), n))
+	}
+	sort.Strings(lines)
+	dir, err := ioutil.TempDir("", "breach")
+	if err != nil {
+		t.Fatalf("unexpected error: %q", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "pwned.txt")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "")), 0600); err != nil {
+		t.Fatalf("unexpected error: %q", err)
+	}
+	return path
+}
+
+func TestFile(t *testing.T) {
+	f, err := Open(writeDataset(t))
+	if err != nil {
+		t.Fatalf("unexpected error opening dataset: %q", err)
+	}
+	defer f.Close()
+	for pw, want := range corpus {
+		if got, err := f.Count([]byte(pw)); err != nil || got != want {
+			t.Fatalf("%q: expected count %d, got %d (%v)", pw, want, got, err)
+		}
+	}
+	for _, pw := range []string{"", "correct horse battery staple", "not in corpus"} {
+		if got, err := f.Count([]byte(pw)); err != nil || got != 0 {
+			t.Fatalf("%q: expected count 0, got %d (%v)", pw, got, err)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	fh, err := os.Open(writeDataset(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %q", err)
+	}
+	defer fh.Close()
+	f, err := BuildFilter(fh, 0.0001, 10)
+	if err != nil {
+		t.Fatalf("unexpected error building filter: %q", err)
+	}
+	buf := &bytes.Buffer{}
+	if _, err := f.WriteTo(buf); err != nil {
+		t.Fatalf("unexpected error writing filter: %q", err)
+	}
+	f, err = ReadFilter(buf)
+	if err != nil {
+		t.Fatalf("unexpected error reading filter: %q", err)
+	}
+	for pw, n := range corpus {
+		got, _ := f.Count([]byte(pw))
+		if n >= 10 && got != 10 {
+			t.Fatalf("%q: expected filter count 10, got %d", pw, got)
+		}
+	}
+	if got, _ := f.Count([]byte("correct horse battery staple")); got != 0 {
+		t.Fatalf("expected filter count 0, got %d", got)
+	}
+}
+
+func TestFilterRate(t *testing.T) {
+	fh, err := os.Open(writeDataset(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %q", err)
+	}
+	defer fh.Close()
+	for _, rate := range []float64{0, 1, -0.5, math.NaN()} {
+		if _, err := BuildFilter(fh, rate, 1); err == nil {
+			t.Fatalf("expected error with false positive rate %g, got none", rate)
+		}
+	}
+}
+
+func TestBadFilter(t *testing.T) {
+	header := func(m uint64, k uint32) []byte {
+		b := append([]byte{}, filterMagic...)
+		b = appendUint64(b, m)
+		b = appendUint32(b, k)
+		return appendUint32(b, 10)
+	}
+	for name, b := range map[string][]byte{
+		"huge m":      header(math.MaxUint64, 3),
+		"too many k":  header(64, 1000),
+		"short":       append(header(1<<39, 3), make([]byte, 64)...),
+		"short small": append(header(128, 3), make([]byte, 8)...),
+	} {
+		if _, err := ReadFilter(bytes.NewReader(b)); err == nil {
+			t.Fatalf("%s: expected error reading filter, got none", name)
+		}
+	}
+}
+
+func TestRule(t *testing.T) {
+	f, err := Open(writeDataset(t))
+	if err != nil {
+		t.Fatalf("unexpected error opening dataset: %q", err)
+	}
+	defer f.Close()
+	p := &policy.Policy{Rules: []policy.Rule{Rule(f, 5)}}
+	if v := policy.Violations(p.Check("user", []byte("monkey"))); len(v) != 1 || v[0].Code != Breached {
+		t.Fatalf("expected breached violation, got %v", v)
+	}
+	if err := p.Check("user", []byte("letmein")); err != nil {
+		t.Fatalf("expected password below threshold to pass, got %q", err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/AgentZombie/dontusepasswords/breach"
+)
+
+func main() {
+	in := flag.String("in", "", "sorted Pwned Passwords SHA-1 dataset")
+	out := flag.String("out", "breach.filter", "filter file to write")
+	fpRate := flag.Float64("fp", 0.001, "false positive rate")
+	minCount := flag.Int("min", 1, "only include hashes seen at least this many times")
+	flag.Parse()
+	if *in == "" {
+		log.Fatal("error: -in is required")
+	}
+
+	infh, err := os.Open(*in)
+	if err != nil {
+		log.Fatal("error: ", err)
+	}
+	defer infh.Close()
+	f, err := breach.BuildFilter(infh, *fpRate, *minCount)
+	if err != nil {
+		log.Fatal("error: building filter: ", err)
+	}
+	outfh, err := os.Create(*out)
+	if err != nil {
+		log.Fatal("error: ", err)
+	}
+	if _, err := f.WriteTo(outfh); err != nil {
+		log.Fatal("error: ", err)
+	}
+	if err := outfh.Close(); err != nil {
+		log.Fatal("error: ", err)
+	}
+	log.Print("wrote filter to ", *out)
+}
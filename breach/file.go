@@ -0,0 +1,115 @@
+package breach
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// maxLine bounds the length of a dataset line: 40 hex digits, a separator,
+// a count, and a line ending.
+const maxLine = 128
+
+// File is a Checker that binary searches a sorted dataset file on disk, so
+// memory use doesn't grow with the size of the dataset. File is safe for
+// concurrent use.
+type File struct {
+	f    *os.File
+	size int64
+}
+
+// Open opens a sorted dataset file.
+func Open(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening breach dataset")
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "reading breach dataset")
+	}
+	return &File{f: f, size: fi.Size()}, nil
+}
+
+// Close closes the underlying file.
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+// Count returns the prevalence count of the password in the dataset.
+func (f *File) Count(password []byte) (int, error) {
+	target := sha1.Sum(password)
+	// Find the smallest offset whose following line isn't less than the
+	// target. Offsets past the last line compare greater than everything.
+	lo, hi := int64(0), f.size+1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, err := f.lineAt(mid)
+		if err != nil {
+			return 0, err
+		}
+		if line == nil {
+			hi = mid
+			continue
+		}
+		sum, _, err := parseLine(line)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Compare(sum[:], target[:]) < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	line, err := f.lineAt(lo)
+	if err != nil || line == nil {
+		return 0, err
+	}
+	sum, count, err := parseLine(line)
+	if err != nil {
+		return 0, err
+	}
+	if sum != target {
+		return 0, nil
+	}
+	return count, nil
+}
+
+// lineAt returns the first complete line starting at or after off, or nil
+// if there is none.
+func (f *File) lineAt(off int64) ([]byte, error) {
+	if off >= f.size {
+		return nil, nil
+	}
+	start := off
+	if off > 0 {
+		// Include the preceding byte so a line starting exactly at off is
+		// found.
+		start = off - 1
+	}
+	buf := make([]byte, 2*maxLine)
+	n, err := f.f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "reading breach dataset")
+	}
+	buf = buf[:n]
+	if off > 0 {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			return nil, nil
+		}
+		buf = buf[i+1:]
+	}
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i]
+	}
+	return buf, nil
+}
@@ -0,0 +1,241 @@
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+var filterMagic = []byte("DUPBLM01")
+
+const (
+	// maxFilterBits bounds the size of a filter read from a file, at 128GiB.
+	maxFilterBits = 1 << 40
+	// maxFilterHashes bounds the number of hash functions of a filter.
+	maxFilterHashes = 64
+	// filterChunk is the number of words read from a filter at once, so a
+	// truncated file is noticed before its claimed size is allocated.
+	filterChunk = 1 << 16
+)
+
+// Filter is a Checker backed by a Bloom filter of the hashes in a dataset
+// whose counts met a minimum when the filter was built. A Bloom filter can
+// report false positives at the rate chosen when it was built, but never
+// false negatives. Because counts aren't stored, Count reports the minimum
+// count for any password the filter may contain. Filter is safe for
+// concurrent use once built.
+type Filter struct {
+	bits     []uint64
+	m        uint64 // Number of bits
+	k        uint32 // Number of hash functions
+	minCount int    // The lowest count of any hash added
+}
+
+// NewFilter creates an empty Filter sized for n hashes with the given false
+// positive rate, which must be between 0 and 1. minCount records the lowest
+// count that will be added.
+func NewFilter(n uint64, fpRate float64, minCount int) *Filter {
+	if n == 0 {
+		n = 1
+	}
+	m := filterBits(n, fpRate)
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	if k > maxFilterHashes {
+		k = maxFilterHashes
+	}
+	return &Filter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		minCount: minCount,
+	}
+}
+
+// filterBits returns the number of bits in a filter for n hashes with the
+// given false positive rate.
+func filterBits(n uint64, fpRate float64) uint64 {
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	return m
+}
+
+// indexes derives the filter positions of a hash by double hashing. SHA-1
+// output is already uniformly distributed so it is used directly.
+func (f *Filter) indexes(sum [sha1.Size]byte, fn func(uint64)) {
+	h1 := binary.LittleEndian.Uint64(sum[0:8])
+	h2 := binary.LittleEndian.Uint64(sum[8:16]) | 1
+	for i := uint64(0); i < uint64(f.k); i++ {
+		fn((h1 + i*h2) % f.m)
+	}
+}
+
+// Add adds a SHA-1 hash to the filter.
+func (f *Filter) Add(sum [sha1.Size]byte) {
+	f.indexes(sum, func(i uint64) {
+		f.bits[i/64] |= 1 << (i % 64)
+	})
+}
+
+// Contains reports whether the filter may contain a SHA-1 hash.
+func (f *Filter) Contains(sum [sha1.Size]byte) bool {
+	found := true
+	f.indexes(sum, func(i uint64) {
+		if f.bits[i/64]&(1<<(i%64)) == 0 {
+			found = false
+		}
+	})
+	return found
+}
+
+// Count returns the filter's minimum count if the password may be in the
+// filter and 0 otherwise.
+func (f *Filter) Count(password []byte) (int, error) {
+	if f.Contains(sha1.Sum(password)) {
+		return f.minCount, nil
+	}
+	return 0, nil
+}
+
+// BuildFilter builds a Filter from a dataset, including only hashes with a
+// count of at least minCount. The dataset is read twice: once to size the
+// filter and once to fill it. The false positive rate must be between 0 and
+// 1.
+func BuildFilter(dataset io.ReadSeeker, fpRate float64, minCount int) (*Filter, error) {
+	if !(fpRate > 0 && fpRate < 1) {
+		return nil, errors.New("false positive rate must be between 0 and 1")
+	}
+	var n uint64
+	if err := eachLine(dataset, func(sum [sha1.Size]byte, count int) {
+		if count >= minCount {
+			n++
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := dataset.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "rewinding breach dataset")
+	}
+	if filterBits(n, fpRate) > maxFilterBits {
+		return nil, errors.New("breach filter too large for false positive rate")
+	}
+	f := NewFilter(n, fpRate, minCount)
+	if err := eachLine(dataset, func(sum [sha1.Size]byte, count int) {
+		if count >= minCount {
+			f.Add(sum)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func eachLine(r io.Reader, fn func([sha1.Size]byte, int)) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		sum, count, err := parseLine(s.Bytes())
+		if err != nil {
+			return err
+		}
+		fn(sum, count)
+	}
+	return errors.Wrap(s.Err(), "reading breach dataset")
+}
+
+// WriteTo writes the filter in a form that ReadFilter can load.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	hdr := make([]byte, 0, len(filterMagic)+16)
+	hdr = append(hdr, filterMagic...)
+	hdr = appendUint64(hdr, f.m)
+	hdr = appendUint32(hdr, f.k)
+	hdr = appendUint32(hdr, uint32(f.minCount))
+	n, err := bw.Write(hdr)
+	written := int64(n)
+	if err != nil {
+		return written, errors.Wrap(err, "writing filter")
+	}
+	buf := make([]byte, 8)
+	for _, b := range f.bits {
+		binary.LittleEndian.PutUint64(buf, b)
+		n, err = bw.Write(buf)
+		written += int64(n)
+		if err != nil {
+			return written, errors.Wrap(err, "writing filter")
+		}
+	}
+	return written, errors.Wrap(bw.Flush(), "writing filter")
+}
+
+// ReadFilter loads a filter written by WriteTo. The bits are read in chunks
+// rather than allocated up front from the header, so a corrupt header on a
+// short file is an error rather than an enormous allocation.
+func ReadFilter(r io.Reader) (*Filter, error) {
+	br := bufio.NewReader(r)
+	hdr := make([]byte, len(filterMagic)+16)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, errors.Wrap(err, "reading filter header")
+	}
+	if !bytes.Equal(hdr[:len(filterMagic)], filterMagic) {
+		return nil, errors.New("not a breach filter")
+	}
+	hdr = hdr[len(filterMagic):]
+	f := &Filter{
+		m:        binary.LittleEndian.Uint64(hdr[0:8]),
+		k:        binary.LittleEndian.Uint32(hdr[8:12]),
+		minCount: int(binary.LittleEndian.Uint32(hdr[12:16])),
+	}
+	if f.m == 0 || f.m > maxFilterBits || f.k == 0 || f.k > maxFilterHashes {
+		return nil, errors.New("invalid breach filter header")
+	}
+	words := int((f.m + 63) / 64)
+	buf := make([]byte, 8*filterChunk)
+	for len(f.bits) < words {
+		n := words - len(f.bits)
+		if n > filterChunk {
+			n = filterChunk
+		}
+		if _, err := io.ReadFull(br, buf[:8*n]); err != nil {
+			return nil, errors.Wrap(err, "reading filter")
+		}
+		for i := 0; i < n; i++ {
+			f.bits = append(f.bits, binary.LittleEndian.Uint64(buf[8*i:]))
+		}
+	}
+	return f, nil
+}
+
+// LoadFilter loads a filter from a file written by WriteTo.
+func LoadFilter(path string) (*Filter, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening filter")
+	}
+	defer fh.Close()
+	return ReadFilter(fh)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return append(b, buf...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	return append(b, buf...)
+}
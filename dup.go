@@ -5,30 +5,64 @@
 package dontusepasswords
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/AgentZombie/dontusepasswords/account"
 	"github.com/AgentZombie/dontusepasswords/auth"
+	"github.com/AgentZombie/dontusepasswords/limit"
+	"github.com/AgentZombie/dontusepasswords/policy"
 )
 
 // AuthResult provides details about the result of an authentication attempt.
 type AuthResult struct {
-	Account  *account.Account // The account object if authentication succeeded
-	Success  bool             // Whether or not authentication succeeded
-	Expired  bool             // Whether or not the challenge is expired
-	Locked   bool             // Whether or not the account is administratively locked
-	NotExist bool             // If no account with that name is found
+	Account     *account.Account // The account object if authentication succeeded
+	Success     bool             // Whether or not authentication succeeded
+	Expired     bool             // Whether or not the challenge is expired
+	Locked      bool             // Whether or not the account is administratively locked
+	NotExist    bool             // If no account with that name is found
+	Throttled   bool             // Whether or not the attempt was refused because the account is temporarily locked after repeated failures
+	RateLimited bool             // Whether or not the attempt was refused by a rate limiter before any verification
+}
+
+// Origin describes where an authentication attempt came from.
+type Origin struct {
+	RemoteAddr string // The client's network address, e.g. from http.Request.RemoteAddr
+	UserAgent  string // The client's user agent
+}
+
+// LockoutPolicy controls the automatic locking of accounts after repeated
+// authentication failures.
+type LockoutPolicy struct {
+	MaxFailures int           // Failures within Window that trigger a lockout
+	Window      time.Duration // How long a failure counts toward MaxFailures; zero means until the next success
+	Duration    time.Duration // Length of the first temporary lockout, doubled for each consecutive lockout
+	MaxDuration time.Duration // Upper bound on the length of a temporary lockout, if non-zero
+	Permanent   bool          // Whether to administratively lock the account instead of locking temporarily
 }
 
 // Accounts is the main point of interaction with dontusepasswords.
 type Accounts struct {
-	Store            account.Store // Storage for accounts
-	PasswordLifetime time.Duration // How long before a password should be rotated
-	AuthType         string        // Name of the auth scheme to use
+	Store            account.Store   // Storage for accounts
+	PasswordLifetime time.Duration   // How long before a password should be rotated
+	AuthType         string          // Name of the auth scheme to use
+	EqualizeTiming   bool            // Whether to verify against a dummy challenge for missing and locked accounts
+	Lockout          *LockoutPolicy  // Automatic lockout after repeated failures, if non-nil
+	Limiters         []limit.Limiter // Rate limits applied to attempts before verification
+	HistorySize      int             // How many previous challenges to keep to prevent reuse
+	Policy           *policy.Policy  // Rules new passwords must satisfy, if non-nil
 }
 
+var (
+	dummyLock       sync.Mutex
+	dummyChallenges = map[string][]byte{}
+)
+
 // Get retrieves and account by name. To perform authentication use Auth() instead.
 func (s Accounts) Get(name string) (*account.Account, error) {
 	return s.Store.Get(name)
@@ -41,26 +75,78 @@ func (s Accounts) Get(name string) (*account.Account, error) {
 // authentication success and authentication failure might return no error.
 //
 // If the account is not found or is locked, no challenge computation is
-// performed. This could provide a means for an attacker to verify the
-// existence of unlocked accounts by comparing the time it takes to process a
-// request related to an existing, unlocked account and one that is not. It is
-// up to the application developer to decide if such protection is warranted.
+// performed unless EqualizeTiming is set. Skipping it could provide a means
+// for an attacker to verify the existence of unlocked accounts by comparing
+// the time it takes to process a request related to an existing, unlocked
+// account and one that is not. With EqualizeTiming set, the attempt is
+// verified against a precomputed challenge of the configured AuthType
+// instead, and the Store is flushed if a failure would have been recorded, so
+// every path costs roughly the same. It is up to the application developer
+// to decide if such protection is warranted.
+//
+// If a Lockout policy is configured, failed attempts are recorded on the
+// Account and flushed to the Store. If the account has failed too often, it
+// is locked either temporarily, in which case Throttled is set in the
+// AuthResult and the attempt isn't verified until the lockout ends, or
+// permanently by setting Locked. A successful attempt clears the failure
+// count. Failures of parallel attempts on the same account are all counted,
+// and an attempt that succeeds after a parallel one has locked the account
+// is refused.
+//
+// If the account's stored challenge is malformed, an error satisfying
+// auth.IsCorrupt is returned and the attempt isn't counted as a failure. The
+// application should report this to an administrator; setting a new
+// challenge with NewChallenge repairs the account.
 //
 // If Expired is true in the AuthResult, the application should prompt the
 // user to update their password.
 //
 // If authentication succeeds but the account challenge (hash) is stored
 // using a different auth type than the one configured for the system (e.g.
-// bcrypt vs scrypt), Auth will attempt to update the stored challenge using
-// the configured auth mechanism. This may fail and return an error. In this
-// case, the application should probably log the error for admin
-// troubleshooting and let the user proceed.
+// bcrypt vs scrypt, or any deprecated auth type), or using weaker parameters
+// than the configured auth type currently uses, Auth will attempt to update
+// the stored challenge using the configured auth mechanism. This may fail
+// and return an error. In this case, the application should probably log the
+// error for admin troubleshooting and let the user proceed. Challenges stored
+// under an alias of the configured auth type aren't recomputed, only
+// relabelled.
 func (s Accounts) Auth(name string, attempt []byte) (*AuthResult, error) {
+	return s.AuthFrom(Origin{}, name, attempt)
+}
+
+// AuthFrom is like Auth but takes details of where the attempt came from.
+// Before the account is looked up, the attempt is checked against each of
+// the configured Limiters. If any refuses it, RateLimited is set in the
+// AuthResult and no further work is done.
+func (s Accounts) AuthFrom(o Origin, name string, attempt []byte) (*AuthResult, error) {
+	return s.AuthContext(context.Background(), o, name, attempt)
+}
+
+// AuthContext is like AuthFrom but gives up with ctx.Err() if ctx is done
+// before verification finishes, e.g. because the client disconnected or a
+// deadline passed. An abandoned attempt is neither a success nor a failure
+// and isn't recorded. Once verification has finished, its outcome is
+// recorded even if ctx is done, so cancelling can't be used to avoid the
+// Lockout policy.
+func (s Accounts) AuthContext(ctx context.Context, o Origin, name string, attempt []byte) (*AuthResult, error) {
 	r := &AuthResult{}
+	la := &limit.Attempt{
+		RemoteAddr: o.RemoteAddr,
+		UserAgent:  o.UserAgent,
+		Name:       name,
+	}
+	for _, l := range s.Limiters {
+		if !l.Allow(la) {
+			r.RateLimited = true
+			return r, nil
+		}
+	}
+	attempt = s.Policy.Normalized(attempt)
 	a, err := s.Get(name)
 	if err != nil {
 		if account.IsNotFound(err) {
 			r.NotExist = true
+			s.dummyVerify(ctx, attempt)
 			return r, nil
 		}
 		return r, errors.Wrap(err, "getting account")
@@ -68,19 +154,85 @@ func (s Accounts) Auth(name string, attempt []byte) (*AuthResult, error) {
 	r.Account = a
 	if a.Locked {
 		r.Locked = true
+		s.dummyVerify(ctx, attempt)
 		return r, nil
 	}
-	r.Success, err = auth.Verify(a.AuthType, a.AuthData, attempt)
+	now := time.Now()
+	if now.Before(a.LockedUntil) {
+		r.Throttled = true
+		s.dummyVerify(ctx, attempt)
+		return r, nil
+	}
+	r.Success, err = auth.VerifyContext(ctx, a.AuthType, a.AuthData, attempt)
 	if err != nil {
 		return r, errors.Wrap(err, "verifying account")
 	}
-	if a.AuthType != s.AuthType {
-		err = s.setChallenge(a, attempt)
-		if err == nil {
-			err = s.Update(a)
+	if !r.Success {
+		if s.Lockout == nil {
+			return r, nil
+		}
+		a, err = s.modify(name, func(a *account.Account) bool {
+			s.recordFailure(a, now)
+			return true
+		})
+		if a != nil {
+			r.Account = a
+		}
+		return r, errors.Wrap(err, "recording failed attempt")
+	}
+
+	// Work out any new challenge before the account is reread, so that the
+	// account isn't held while it's computed.
+	verified := a.AuthData
+	authType, authData := a.AuthType, a.AuthData
+	rehash := auth.Canonical(a.AuthType) != auth.Canonical(s.AuthType)
+	if !rehash && a.AuthType != s.AuthType {
+		// An alias of the configured AuthType only needs relabelling.
+		authType = s.AuthType
+	}
+	if !rehash {
+		rehash, err = auth.NeedsRehash(s.AuthType, a.AuthData)
+		if err != nil {
+			return r, errors.Wrap(err, "checking challenge parameters")
+		}
+	}
+	var rehashErr error
+	if rehash {
+		c := &account.Account{}
+		if rehashErr = s.setChallenge(ctx, c, attempt); rehashErr == nil {
+			authType, authData = c.AuthType, c.AuthData
 		}
 	}
-	return r, err
+
+	a, err = s.modify(name, func(a *account.Account) bool {
+		// Attempts verified in parallel may have locked the account in
+		// the meantime.
+		switch {
+		case a.Locked:
+			r.Success, r.Locked = false, true
+			return false
+		case now.Before(a.LockedUntil):
+			r.Success, r.Throttled = false, true
+			return false
+		}
+		update := clearFailures(a)
+		// Don't undo a challenge set while the attempt was verified.
+		if bytes.Equal(a.AuthData, verified) && (a.AuthType != authType || !bytes.Equal(a.AuthData, authData)) {
+			a.AuthType, a.AuthData = authType, authData
+			update = true
+		}
+		return update
+	})
+	if a != nil {
+		r.Account = a
+	}
+	if err != nil {
+		return r, errors.Wrap(err, "recording successful attempt")
+	}
+	if !r.Success {
+		return r, nil
+	}
+	return r, rehashErr
 }
 
 // New creates a new Account object, returning an error if an account with
@@ -97,6 +249,16 @@ func (s Accounts) New(name string) (*account.Account, error) {
 
 // Updates the Account object in the store and calls the store's Flush() method.
 func (s Accounts) Update(a *account.Account) error {
+	return s.UpdateContext(context.Background(), a)
+}
+
+// UpdateContext is like Update but returns ctx.Err() without touching the
+// store if ctx is already done. Once started, the update and flush are
+// completed regardless of ctx so the store isn't left half updated.
+func (s Accounts) UpdateContext(ctx context.Context, a *account.Account) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	err := s.Store.Update(a)
 	if err != nil {
 		return errors.Wrap(err, "updating account")
@@ -111,20 +273,49 @@ func (s Accounts) Update(a *account.Account) error {
 // Update the challenge value for the Account object and updates the expiration
 // time. The underlying store is not updated.
 //
-// No restrictions are placed on passwords here. The application should not
-// exclude any characters. It's reasonable for the application to impose a
-// minimum length. The application should be very generous on maximum length
-// (e.g. 256 characters).
+// If a Policy is configured, the value is normalized and checked against it
+// and an error satisfying policy.IsViolation is returned if it fails.
+// Attempts passed to Auth are normalized the same way, so enabling
+// normalization may lock out accounts with non-normalized passwords.
+// Otherwise, no restrictions are placed on passwords here. The application
+// should not exclude any characters. It's reasonable for the application to
+// impose a minimum length. The application should be very generous on
+// maximum length (e.g. 256 characters).
+//
+// If HistorySize is set, the new value is checked against the current
+// challenge and the account's History and an error satisfying IsReused is
+// returned if it matches any of them. Each check costs a full verification.
 func (s Accounts) NewChallenge(a *account.Account, v []byte) error {
-	if err := s.setChallenge(a, v); err != nil {
+	return s.NewChallengeContext(context.Background(), a, v)
+}
+
+// NewChallengeContext is like NewChallenge but gives up with ctx.Err() if
+// ctx is done before the history checks and new challenge are computed, in
+// which case the new challenge isn't set.
+func (s Accounts) NewChallengeContext(ctx context.Context, a *account.Account, v []byte) error {
+	if s.Policy != nil {
+		v = s.Policy.Normalized(v)
+		if err := s.Policy.Check(a.Name, v); err != nil {
+			return err
+		}
+	}
+	if err := s.checkHistory(ctx, a, v); err != nil {
+		return err
+	}
+	prev := account.Challenge{AuthType: a.AuthType, AuthData: a.AuthData}
+	if err := s.setChallenge(ctx, a, v); err != nil {
 		return errors.Wrap(err, "setting new challenge")
 	}
+	s.pushHistory(a, prev)
 	s.touchExpiration(a)
 	return nil
 }
 
-func (s Accounts) setChallenge(a *account.Account, v []byte) error {
-	v, err := auth.Compute(s.AuthType, v)
+func (s Accounts) setChallenge(ctx context.Context, a *account.Account, v []byte) error {
+	if auth.IsDeprecated(s.AuthType) {
+		return errors.New("configured auth type " + s.AuthType + " is deprecated")
+	}
+	v, err := auth.ComputeContext(ctx, s.AuthType, v)
 	if err != nil {
 		return errors.Wrap(err, "computing new challenge for account")
 	}
@@ -133,6 +324,157 @@ func (s Accounts) setChallenge(a *account.Account, v []byte) error {
 	return nil
 }
 
+// modify rereads the named account, applies f to it, and stores it if f
+// returns true, returning the account. Stores that implement
+// account.Modifier do this atomically; otherwise accounts are locked by
+// name while this happens. Either way concurrent modifications, e.g.
+// failures counted by parallel attempts, aren't lost.
+func (s Accounts) modify(name string, f func(a *account.Account) bool) (*account.Account, error) {
+	if m, ok := s.Store.(account.Modifier); ok {
+		changed := false
+		a, err := m.Modify(name, func(a *account.Account) bool {
+			changed = f(a)
+			return changed
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "modifying account")
+		}
+		if changed {
+			err = errors.Wrap(s.Store.Flush(), "flushing account update")
+		}
+		return a, err
+	}
+	unlock := lockName(name)
+	defer unlock()
+	a, err := s.Store.Get(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting account")
+	}
+	if !f(a) {
+		return a, nil
+	}
+	return a, s.Update(a)
+}
+
+// nameLock is held while an account is modified.
+type nameLock struct {
+	sync.Mutex
+	users int
+}
+
+var (
+	nameLocksLock sync.Mutex
+	nameLocks     = map[string]*nameLock{}
+)
+
+// lockName locks the account with the given name against concurrent
+// modification by modify and returns a function that unlocks it. Locks are
+// by name alone, so accounts with the same name in different stores share
+// a lock.
+func lockName(name string) func() {
+	nameLocksLock.Lock()
+	l, ok := nameLocks[name]
+	if !ok {
+		l = &nameLock{}
+		nameLocks[name] = l
+	}
+	l.users++
+	nameLocksLock.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		nameLocksLock.Lock()
+		if l.users--; l.users == 0 {
+			delete(nameLocks, name)
+		}
+		nameLocksLock.Unlock()
+	}
+}
+
+// recordFailure counts a failed attempt against the account and locks it if
+// the Lockout policy's threshold is reached.
+func (s Accounts) recordFailure(a *account.Account, now time.Time) {
+	p := s.Lockout
+	if p != nil && p.Window > 0 && now.Sub(a.LastFailure) > p.Window {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailure = now
+	if p == nil || p.MaxFailures <= 0 || a.Failures < p.MaxFailures {
+		return
+	}
+	a.Failures = 0
+	if p.Permanent {
+		a.Locked = true
+		return
+	}
+	a.Lockouts++
+	a.LockedUntil = now.Add(p.lockDuration(a.Lockouts))
+}
+
+// clearFailures resets failure tracking after a successful attempt and
+// reports whether anything changed.
+func clearFailures(a *account.Account) bool {
+	if a.Failures == 0 && a.Lockouts == 0 && a.LockedUntil.IsZero() {
+		return false
+	}
+	a.Failures = 0
+	a.Lockouts = 0
+	a.LockedUntil = time.Time{}
+	return true
+}
+
+// lockDuration returns the length of the nth consecutive temporary lockout.
+func (p *LockoutPolicy) lockDuration(n int) time.Duration {
+	d := p.Duration
+	for i := 1; i < n && d < 1<<61; i++ {
+		d *= 2
+	}
+	if p.MaxDuration > 0 && d > p.MaxDuration {
+		d = p.MaxDuration
+	}
+	return d
+}
+
 func (s Accounts) touchExpiration(a *account.Account) {
 	a.Expires = time.Now().Add(s.PasswordLifetime)
 }
+
+// dummyVerify verifies attempt against a challenge of the configured auth
+// type that no attempt matches, to spend the same time as a real
+// verification. If failures are recorded, it also flushes the Store as
+// recording one would. It does nothing unless EqualizeTiming is set.
+func (s Accounts) dummyVerify(ctx context.Context, attempt []byte) {
+	if !s.EqualizeTiming {
+		return
+	}
+	c, err := dummyChallenge(s.AuthType)
+	if err != nil {
+		return
+	}
+	auth.VerifyContext(ctx, s.AuthType, c, attempt)
+	if s.Lockout != nil {
+		s.Store.Flush()
+	}
+}
+
+// dummyChallenge returns a challenge for authtype computed from random data,
+// computing it on first use.
+func dummyChallenge(authtype string) ([]byte, error) {
+	dummyLock.Lock()
+	defer dummyLock.Unlock()
+	if c, ok := dummyChallenges[authtype]; ok {
+		return c, nil
+	}
+	v := make([]byte, 32)
+	if _, err := rand.Read(v); err != nil {
+		return nil, errors.Wrap(err, "reading random bytes")
+	}
+	c, err := auth.Compute(authtype, v)
+	if err != nil {
+		return nil, errors.Wrap(err, "computing dummy challenge")
+	}
+	dummyChallenges[authtype] = c
+	return c, nil
+}
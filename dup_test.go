@@ -0,0 +1,439 @@
+package dontusepasswords
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+	"github.com/AgentZombie/dontusepasswords/account/json"
+	"github.com/AgentZombie/dontusepasswords/auth"
+	"github.com/AgentZombie/dontusepasswords/limit"
+	"github.com/AgentZombie/dontusepasswords/policy"
+)
+
+const (
+	slowAuthType       = "TESTSLOW"
+	slowAliasType      = "TESTSLOWALIAS"
+	slowDeprecatedType = "TESTSLOWDEPRECATED"
+)
+
+// slowAuth is a ComputerVerifier that takes a fixed, noticeable amount of
+// time so timing differences between code paths are measurable.
+type slowAuth struct{}
+
+func (slowAuth) Compute(v []byte) ([]byte, error) {
+	time.Sleep(5 * time.Millisecond)
+	return append([]byte(nil), v...), nil
+}
+
+func (slowAuth) Verify(challenge, attempt []byte) (bool, error) {
+	time.Sleep(5 * time.Millisecond)
+	if len(challenge) == 0 {
+		return false, &auth.CorruptError{Str: "empty challenge"}
+	}
+	return bytes.Equal(challenge, attempt), nil
+}
+
+func init() {
+	auth.Register(slowAuthType, slowAuth{})
+	auth.Alias(slowAliasType, slowAuthType)
+	auth.Register(slowDeprecatedType, slowAuth{})
+	auth.Deprecate(slowDeprecatedType)
+}
+
+// memStore is a minimal in-memory account.Store.
+type memStore map[string]*account.Account
+
+func (m memStore) Get(name string) (*account.Account, error) {
+	if a, ok := m[name]; ok {
+		return a, nil
+	}
+	return nil, &account.NotFoundError{Str: "not found"}
+}
+
+func (m memStore) Update(a *account.Account) error {
+	m[a.Name] = a
+	return nil
+}
+
+func (m memStore) Flush() error {
+	return nil
+}
+
+func (m memStore) Names() ([]string, error) {
+	names := []string{}
+	for name := range m {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (m memStore) Delete(name string) error {
+	delete(m, name)
+	return nil
+}
+
+func (m memStore) Rename(newname string, a *account.Account) error {
+	delete(m, a.Name)
+	a.Name = newname
+	m[newname] = a
+	return nil
+}
+
+func newTestAccounts(t *testing.T) Accounts {
+	s := Accounts{
+		Store:            memStore{},
+		PasswordLifetime: time.Hour,
+		AuthType:         slowAuthType,
+	}
+	for _, name := range []string{"user", "locked"} {
+		a, err := s.New(name)
+		if err != nil {
+			t.Fatalf("unexpected error creating account: %q", err)
+		}
+		if err := s.NewChallenge(a, []byte("password")); err != nil {
+			t.Fatalf("unexpected error setting challenge: %q", err)
+		}
+		a.Locked = name == "locked"
+		if err := s.Update(a); err != nil {
+			t.Fatalf("unexpected error updating account: %q", err)
+		}
+	}
+	return s
+}
+
+// timeAuth returns the minimum and maximum durations of n authentication
+// attempts.
+func timeAuth(t *testing.T, s Accounts, name string, n int) (time.Duration, time.Duration) {
+	var min, max time.Duration
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		if _, err := s.Auth(name, []byte("wrong")); err != nil {
+			t.Fatalf("unexpected error authenticating: %q", err)
+		}
+		d := time.Since(start)
+		if i == 0 || d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+	}
+	return min, max
+}
+
+func TestEqualizeTiming(t *testing.T) {
+	s := newTestAccounts(t)
+	const n = 10
+
+	existMin, existMax := timeAuth(t, s, "user", n)
+	missingMin, missingMax := timeAuth(t, s, "nosuchuser", n)
+	if missingMax >= existMin {
+		t.Fatalf("expected unequalized missing account to be faster: missing %s-%s, existing %s-%s",
+			missingMin, missingMax, existMin, existMax)
+	}
+	if a, _ := s.Get("user"); a.Failures != 0 {
+		t.Fatalf("expected failures not to be recorded without a lockout policy, got %d", a.Failures)
+	}
+
+	s.EqualizeTiming = true
+	existMin, existMax = timeAuth(t, s, "user", n)
+	for _, name := range []string{"nosuchuser", "locked"} {
+		min, max := timeAuth(t, s, name, n)
+		if min > existMax || existMin > max {
+			t.Fatalf("expected %s timing %s-%s to overlap existing account timing %s-%s",
+				name, min, max, existMin, existMax)
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	s := newTestAccounts(t)
+	s.Lockout = &LockoutPolicy{
+		MaxFailures: 3,
+		Window:      time.Hour,
+		Duration:    time.Minute,
+		MaxDuration: 90 * time.Second,
+	}
+	for i := 0; i < 3; i++ {
+		r, err := s.Auth("user", []byte("wrong"))
+		if err != nil || r.Success || r.Throttled {
+			t.Fatalf("unexpected result for failure %d: %+v, %v", i, r, err)
+		}
+	}
+	r, err := s.Auth("user", []byte("password"))
+	if err != nil || r.Success || !r.Throttled {
+		t.Fatalf("expected throttled attempt, got %+v, %v", r, err)
+	}
+	a, _ := s.Get("user")
+	if d := time.Until(a.LockedUntil); d <= 0 || d > time.Minute {
+		t.Fatalf("expected first lockout of about a minute, got %s", d)
+	}
+
+	// Expire the lockout and fail again to trigger a longer, capped one.
+	a.LockedUntil = time.Now().Add(-time.Second)
+	for i := 0; i < 3; i++ {
+		s.Auth("user", []byte("wrong"))
+	}
+	if d := time.Until(a.LockedUntil); d <= time.Minute || d > 90*time.Second {
+		t.Fatalf("expected capped second lockout, got %s", d)
+	}
+
+	a.LockedUntil = time.Now().Add(-time.Second)
+	r, err = s.Auth("user", []byte("password"))
+	if err != nil || !r.Success {
+		t.Fatalf("expected success after lockout, got %+v, %v", r, err)
+	}
+	if a.Failures != 0 || a.Lockouts != 0 || !a.LockedUntil.IsZero() {
+		t.Fatalf("expected failure tracking to be cleared, got %+v", a)
+	}
+}
+
+func TestEqualizeTimingStore(t *testing.T) {
+	store, err := json.New(filepath.Join(t.TempDir(), "accounts.json"), true)
+	if err != nil {
+		t.Fatalf("unexpected error creating store: %q", err)
+	}
+	s := Accounts{
+		Store:            store,
+		PasswordLifetime: time.Hour,
+		AuthType:         slowAuthType,
+		EqualizeTiming:   true,
+		Lockout:          &LockoutPolicy{MaxFailures: 1000, Duration: time.Hour},
+	}
+	// Enough accounts that flushing the store takes a while.
+	for i := 0; i < 2000; i++ {
+		a := &account.Account{
+			Name:     fmt.Sprintf("user%d", i),
+			AuthType: slowAuthType,
+			AuthData: []byte("password"),
+			Locked:   i == 1,
+		}
+		if err := store.Update(a); err != nil {
+			t.Fatalf("unexpected error updating account: %q", err)
+		}
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing store: %q", err)
+	}
+	const n = 10
+	existMin, existMax := timeAuth(t, s, "user0", n)
+	for _, name := range []string{"nosuchuser", "user1"} {
+		min, max := timeAuth(t, s, name, n)
+		if min > existMax || existMin > max {
+			t.Fatalf("expected %s timing %s-%s to overlap existing account timing %s-%s",
+				name, min, max, existMin, existMax)
+		}
+	}
+}
+
+func TestConcurrentLockout(t *testing.T) {
+	store, err := json.New(filepath.Join(t.TempDir(), "accounts.json"), true)
+	if err != nil {
+		t.Fatalf("unexpected error creating store: %q", err)
+	}
+	s := Accounts{
+		Store:            store,
+		PasswordLifetime: time.Hour,
+		AuthType:         slowAuthType,
+		Lockout:          &LockoutPolicy{MaxFailures: 5, Duration: time.Hour},
+	}
+	a, _ := s.New("user")
+	s.NewChallenge(a, []byte("password"))
+	s.Update(a)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Auth("user", []byte("wrong")); err != nil {
+				t.Errorf("unexpected error authenticating: %q", err)
+			}
+		}()
+	}
+	wg.Wait()
+	a, _ = s.Get("user")
+	if !time.Now().Before(a.LockedUntil) {
+		t.Fatalf("expected parallel failures to lock the account, got %+v", a)
+	}
+	if r, err := s.Auth("user", []byte("password")); err != nil || r.Success || !r.Throttled {
+		t.Fatalf("expected throttled attempt, got %+v, %v", r, err)
+	}
+}
+
+func TestPermanentLockout(t *testing.T) {
+	s := newTestAccounts(t)
+	s.Lockout = &LockoutPolicy{
+		MaxFailures: 2,
+		Permanent:   true,
+	}
+	for i := 0; i < 2; i++ {
+		s.Auth("user", []byte("wrong"))
+	}
+	r, err := s.Auth("user", []byte("password"))
+	if err != nil || r.Success || !r.Locked {
+		t.Fatalf("expected locked account, got %+v, %v", r, err)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	s := newTestAccounts(t)
+	s.Limiters = []limit.Limiter{limit.NewTokenBucket(limit.BySource, 0, 1)}
+	o := Origin{RemoteAddr: "192.0.2.1:1234"}
+	if r, err := s.AuthFrom(o, "user", []byte("password")); err != nil || !r.Success {
+		t.Fatalf("expected success, got %+v, %v", r, err)
+	}
+	r, err := s.AuthFrom(o, "user", []byte("password"))
+	if err != nil || r.Success || !r.RateLimited || r.Account != nil {
+		t.Fatalf("expected rate limited attempt, got %+v, %v", r, err)
+	}
+	if r, err := s.AuthFrom(Origin{RemoteAddr: "192.0.2.2:1234"}, "user", []byte("password")); err != nil || !r.Success {
+		t.Fatalf("expected success from another source, got %+v, %v", r, err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	s := newTestAccounts(t)
+	s.HistorySize = 2
+	a, _ := s.Get("user")
+	if err := s.NewChallenge(a, []byte("password")); !IsReused(err) {
+		t.Fatalf("expected reused error for current password, got %v", err)
+	}
+	for _, pw := range []string{"second", "third", "fourth"} {
+		if err := s.NewChallenge(a, []byte(pw)); err != nil {
+			t.Fatalf("unexpected error setting %q: %q", pw, err)
+		}
+	}
+	if len(a.History) != 2 {
+		t.Fatalf("expected history trimmed to 2, got %d", len(a.History))
+	}
+	if err := s.NewChallenge(a, []byte("second")); !IsReused(err) {
+		t.Fatalf("expected reused error for previous password, got %v", err)
+	}
+	if err := s.NewChallenge(a, []byte("password")); err != nil {
+		t.Fatalf("expected password older than history to be accepted, got %q", err)
+	}
+
+	a.History = append(a.History, account.Challenge{AuthType: "NoSuchAuthType", AuthData: []byte("x")})
+	if err := s.NewChallenge(a, []byte("fifth")); err != nil {
+		t.Fatalf("unexpected error with unregistered history entry: %q", err)
+	}
+	for _, c := range a.History {
+		if c.AuthType == "NoSuchAuthType" {
+			t.Fatal("expected unregistered history entry to be dropped")
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	s := newTestAccounts(t)
+	s.Policy = policy.Default()
+	a, _ := s.Get("user")
+	err := s.NewChallenge(a, []byte("user1"))
+	if v := policy.Violations(err); len(v) != 2 {
+		t.Fatalf("expected 2 violations, got %v", err)
+	}
+	// U+212B ANGSTROM SIGN normalizes to U+00C5.
+	if err := s.NewChallenge(a, []byte("Ångström")); err != nil {
+		t.Fatalf("unexpected error: %q", err)
+	}
+	if r, err := s.Auth("user", []byte("Ångström")); err != nil || !r.Success {
+		t.Fatalf("expected normalized attempt to succeed, got %+v, %v", r, err)
+	}
+}
+
+func TestAuthContext(t *testing.T) {
+	s := newTestAccounts(t)
+	s.Lockout = &LockoutPolicy{MaxFailures: 1, Duration: time.Minute}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	r, err := s.AuthContext(ctx, Origin{}, "user", []byte("wrong"))
+	if err == nil || errors.Cause(err) != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if r.Success || r.Account.Failures != 0 || !r.Account.LockedUntil.IsZero() {
+		t.Fatal("expected abandoned attempt not to be recorded")
+	}
+
+	r, err = s.AuthContext(context.Background(), Origin{}, "user", []byte("password"))
+	if err != nil || !r.Success {
+		t.Fatalf("expected success without deadline, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	old := r.Account.AuthData
+	if err := s.NewChallengeContext(ctx, r.Account, []byte("new password")); errors.Cause(err) != context.Canceled {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	if !bytes.Equal(r.Account.AuthData, old) {
+		t.Fatal("expected challenge to be unchanged")
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	s := newTestAccounts(t)
+	a, _ := s.Get("user")
+	a.AuthData = nil
+	r, err := s.Auth("user", []byte("password"))
+	if !auth.IsCorrupt(err) || r.Success {
+		t.Fatalf("expected corrupt challenge error, got %+v, %v", r, err)
+	}
+	if r.Account.Failures != 0 {
+		t.Fatal("expected corrupt challenge not to count as a failure")
+	}
+	if err := s.NewChallenge(a, []byte("password")); err != nil {
+		t.Fatalf("unexpected error repairing account: %q", err)
+	}
+	if r, err := s.Auth("user", []byte("password")); err != nil || !r.Success {
+		t.Fatalf("expected success after repair, got %+v, %v", r, err)
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	s := newTestAccounts(t)
+	u, _ := s.Get("user")
+	u.AuthType = slowAliasType
+	l, _ := s.Get("locked")
+	l.AuthType = slowDeprecatedType
+	report, err := s.Report()
+	if err != nil {
+		t.Fatalf("unexpected error reporting: %q", err)
+	}
+	expected := []TypeCount{
+		{AuthType: slowAuthType, Accounts: 1, Registered: true},
+		{AuthType: slowDeprecatedType, Accounts: 1, Deprecated: true, Registered: true},
+	}
+	if len(report) != len(expected) || report[0] != expected[0] || report[1] != expected[1] {
+		t.Fatalf("expected report %+v, got %+v", expected, report)
+	}
+
+	old := u.AuthData
+	if r, err := s.Auth("user", []byte("password")); err != nil || !r.Success {
+		t.Fatalf("expected success through alias, got %+v, %v", r, err)
+	}
+	if u.AuthType != slowAuthType || !bytes.Equal(u.AuthData, old) {
+		t.Fatal("expected alias to be relabelled without rehashing")
+	}
+
+	l.Locked = false
+	if r, err := s.Auth("locked", []byte("password")); err != nil || !r.Success {
+		t.Fatalf("expected success with deprecated type, got %+v, %v", r, err)
+	}
+	if l.AuthType != slowAuthType {
+		t.Fatalf("expected deprecated type to be upgraded, got %s", l.AuthType)
+	}
+
+	s.AuthType = slowDeprecatedType
+	if err := s.NewChallenge(u, []byte("new password")); err == nil {
+		t.Fatal("expected error setting challenge with deprecated type, got none")
+	}
+}
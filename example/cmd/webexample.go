@@ -2,13 +2,19 @@ package main
 
 import (
 	"log"
+	"runtime"
 	"time"
 
 	"github.com/AgentZombie/dontusepasswords"
 	"github.com/AgentZombie/dontusepasswords/account/json"
+	"github.com/AgentZombie/dontusepasswords/auth"
+	_ "github.com/AgentZombie/dontusepasswords/auth/argon2"
 	_ "github.com/AgentZombie/dontusepasswords/auth/bcrypt"
 	_ "github.com/AgentZombie/dontusepasswords/auth/scrypt"
 	"github.com/AgentZombie/dontusepasswords/example"
+	"github.com/AgentZombie/dontusepasswords/limit"
+	"github.com/AgentZombie/dontusepasswords/policy"
+	"github.com/AgentZombie/dontusepasswords/strength"
 )
 
 const (
@@ -22,11 +28,31 @@ func fatalIfError(err error) {
 	}
 }
 
+func examplePolicy() *policy.Policy {
+	p := policy.Default()
+	p.Rules = append(p.Rules, strength.Rule(3, "dontusepasswords", "example"))
+	return p
+}
+
 func main() {
 	sessionDuration := time.Hour * 20
 	sessions := example.NewSessions(sessionDuration)
 
-	accountStore, err := json.New(AccountsPath, true)
+	// Bound the hashing work so a login flood is refused rather than
+	// starving the server.
+	fatalIfError(auth.SetLimits("BCRYPTDEFAULT", auth.Limits{
+		MaxInFlight: runtime.NumCPU(),
+		MaxQueue:    64,
+		Timeout:     2 * time.Second,
+	}))
+
+	// Every login attempt flushes the store to record failures, so keep
+	// at most one backup an hour rather than one per attempt.
+	accountStore, err := json.Open(AccountsPath, json.Options{
+		Create:         true,
+		Backups:        5,
+		BackupInterval: time.Hour,
+	})
 	if err != nil {
 		log.Fatal("error: ", err)
 	}
@@ -34,6 +60,19 @@ func main() {
 		Store:            accountStore,
 		PasswordLifetime: 24 * time.Hour * 365,
 		AuthType:         "BCRYPTDEFAULT",
+		EqualizeTiming:   true,
+		HistorySize:      5,
+		Policy:           examplePolicy(),
+		Lockout: &dontusepasswords.LockoutPolicy{
+			MaxFailures: 5,
+			Window:      15 * time.Minute,
+			Duration:    time.Minute,
+			MaxDuration: time.Hour,
+		},
+		Limiters: []limit.Limiter{
+			limit.NewTokenBucket(limit.BySource, 1, 10),
+			limit.NewTokenBucket(limit.ByAccount, 0.2, 5),
+		},
 	}
 	if _, err := accounts.Get("admin"); err != nil {
 		admin, err := accounts.New("admin")
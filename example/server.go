@@ -4,10 +4,13 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"html"
 	"log"
 	"net/http"
 
 	"github.com/AgentZombie/dontusepasswords"
+	"github.com/AgentZombie/dontusepasswords/auth"
+	"github.com/AgentZombie/dontusepasswords/policy"
 )
 
 const (
@@ -100,10 +103,30 @@ func (s *Server) LoginAttempt(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 	password := []byte(r.FormValue("password"))
 	log.Print("login attempt for user ", username)
-	res, err := s.accounts.Auth(username, password)
+	res, err := s.accounts.AuthContext(r.Context(), dontusepasswords.Origin{
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}, username, password)
 	if err != nil {
 		log.Print("error: ", err)
 	}
+	if r.Context().Err() != nil {
+		log.Print("login abandoned for user ", username)
+		return
+	}
+	if auth.IsBusy(err) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Server busy, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	if res.RateLimited {
+		log.Print("login rate limited for user ", username, " from ", r.RemoteAddr)
+		http.Error(w, "Too many login attempts", http.StatusTooManyRequests)
+		return
+	}
+	if res.Throttled {
+		log.Print("login throttled for user ", username)
+	}
 	if !res.Success {
 		log.Print("login failed for user ", username)
 		http.Redirect(w, r, "/login", http.StatusFound)
@@ -154,10 +177,13 @@ func (s *Server) AddUserAttempt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	a.AuxData = []byte(color)
-	if err = s.accounts.NewChallenge(a, password); err != nil {
+	if err = s.accounts.NewChallengeContext(r.Context(), a, password); err != nil {
+		if passwordRejected(w, err) {
+			return
+		}
 		log.Print("error: setting account challenge: ", err)
 	}
-	if err = s.accounts.Update(a); err != nil {
+	if err = s.accounts.UpdateContext(r.Context(), a); err != nil {
 		log.Print("error: updating account: ", err)
 	}
 	log.Print("adding user succeeded")
@@ -203,15 +229,54 @@ func (s *Server) ChangePasswordAttempt(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/changepassword", http.StatusFound)
 		return
 	}
-	if err = s.accounts.NewChallenge(a, password); err != nil {
+	if err = s.accounts.NewChallengeContext(r.Context(), a, password); err != nil {
+		if passwordRejected(w, err) {
+			log.Print("new password rejected for user ", sess.Username)
+			return
+		}
 		log.Print("error calculating password: ", err)
 	}
-	if err = s.accounts.Update(a); err != nil {
+	if err = s.accounts.UpdateContext(r.Context(), a); err != nil {
 		log.Print("error updating account: ", err)
 	}
 	http.Redirect(w, r, "/logout", http.StatusFound)
 }
 
+// passwordRejected writes a page explaining why a new password wasn't
+// accepted. It returns false without writing anything if err doesn't
+// indicate a rejected password.
+func passwordRejected(w http.ResponseWriter, err error) bool {
+	var reasons []string
+	switch {
+	case policy.IsViolation(err):
+		for _, v := range policy.Violations(err) {
+			reasons = append(reasons, "Password "+v.Message)
+			reasons = append(reasons, v.Feedback...)
+		}
+	case dontusepasswords.IsReused(err):
+		reasons = []string{"That password was used recently, choose another"}
+	default:
+		return false
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(`
+<html>
+<head><title>Password Rejected</title></head>
+<body>
+<h1>Password Rejected</h1>
+<ul>
+`))
+	for _, r := range reasons {
+		w.Write([]byte("<li>" + html.EscapeString(r) + "</li>\n"))
+	}
+	w.Write([]byte(`</ul>
+<div><a href="/">Back</a></div>
+</body>
+</html>
+`))
+	return true
+}
+
 func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
 	if sess, ok := r.Context().Value(SessionContextKey).(*Session); ok {
 		s.sessions.Delete(sess.Id)
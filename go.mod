@@ -1,8 +1,11 @@
 module github.com/AgentZombie/dontusepasswords
 
-go 1.13
+go 1.18
 
 require (
 	github.com/pkg/errors v0.8.1
 	golang.org/x/crypto v0.17.0
+	golang.org/x/text v0.14.0
 )
+
+require golang.org/x/sys v0.15.0 // indirect
@@ -0,0 +1,91 @@
+package dontusepasswords
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+	"github.com/AgentZombie/dontusepasswords/auth"
+)
+
+// Reused can be implemented by errors to indicate that a new challenge value
+// matches one the account has used before.
+type Reused interface {
+	IsReused() bool
+}
+
+// IsReused checks whether or not an error indicates that a password was
+// reused.
+func IsReused(err error) bool {
+	if r, ok := errors.Cause(err).(Reused); ok {
+		return r.IsReused()
+	}
+	return false
+}
+
+type reusedError struct{}
+
+func (reusedError) Error() string {
+	return "password was used previously"
+}
+
+func (reusedError) IsReused() bool {
+	return true
+}
+
+// checkHistory returns a reusedError if v matches the account's current
+// challenge or any challenge in its History. History entries whose auth
+// type is no longer registered or that are corrupt can't be checked and are
+// dropped; a corrupt current challenge is ignored so it can be replaced.
+//
+// Previous challenges can't be recomputed with a new AuthType because the
+// values they were computed from aren't known. Instead, they keep their
+// original auth type and age out of the History as new challenges are set.
+// Because Auth recomputes the current challenge with the configured
+// AuthType, the History converges on the configured AuthType over time.
+func (s Accounts) checkHistory(ctx context.Context, a *account.Account, v []byte) error {
+	if s.HistorySize <= 0 {
+		return nil
+	}
+	if len(a.AuthData) > 0 {
+		match, err := auth.VerifyContext(ctx, a.AuthType, a.AuthData, v)
+		if err != nil && !auth.IsInvalidType(err) && !auth.IsCorrupt(err) {
+			return errors.Wrap(err, "checking current challenge")
+		}
+		if match {
+			return reusedError{}
+		}
+	}
+	kept := make([]account.Challenge, 0, len(a.History))
+	for _, c := range a.History {
+		match, err := auth.VerifyContext(ctx, c.AuthType, c.AuthData, v)
+		if auth.IsInvalidType(err) || auth.IsCorrupt(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "checking challenge history")
+		}
+		if match {
+			return reusedError{}
+		}
+		kept = append(kept, c)
+	}
+	a.History = kept
+	return nil
+}
+
+// pushHistory records prev as the most recent previous challenge and trims
+// the History to HistorySize.
+func (s Accounts) pushHistory(a *account.Account, prev account.Challenge) {
+	if s.HistorySize <= 0 {
+		a.History = nil
+		return
+	}
+	if len(prev.AuthData) > 0 {
+		a.History = append([]account.Challenge{prev}, a.History...)
+	}
+	if len(a.History) > s.HistorySize {
+		a.History = a.History[:s.HistorySize]
+	}
+}
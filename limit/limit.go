@@ -0,0 +1,132 @@
+// package limit provides rate limiting of authentication attempts so that
+// password guessing can be throttled before any challenge computation is
+// performed.
+package limit
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// pruneEvery is how many calls to Allow pass between removals of idle
+// buckets.
+const pruneEvery = 1024
+
+// MaxIdle is how long a bucket may go unused before it's forgotten, even if
+// it hasn't refilled, so that buckets that refill slowly, or never with a
+// rate of zero, don't accumulate without bound.
+var MaxIdle = 24 * time.Hour
+
+// Attempt describes an authentication attempt being rate limited.
+type Attempt struct {
+	RemoteAddr string // The client's network address, e.g. from http.Request.RemoteAddr
+	UserAgent  string // The client's user agent
+	Name       string // The account name being authenticated
+}
+
+// Source returns the host portion of RemoteAddr, or RemoteAddr itself if it
+// has no port.
+func (a *Attempt) Source() string {
+	host, _, err := net.SplitHostPort(a.RemoteAddr)
+	if err != nil {
+		return a.RemoteAddr
+	}
+	return host
+}
+
+// Limiter objects decide whether an authentication attempt may proceed.
+type Limiter interface {
+	Allow(a *Attempt) bool
+}
+
+// KeyFunc selects what an Attempt is limited by. Attempts with an empty key
+// are not limited.
+type KeyFunc func(a *Attempt) string
+
+// BySource limits attempts by the client's address.
+func BySource(a *Attempt) string {
+	return a.Source()
+}
+
+// ByAccount limits attempts by account name.
+func ByAccount(a *Attempt) string {
+	return a.Name
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time // When tokens was last refilled
+	used   time.Time // When the bucket was last used by an attempt
+}
+
+// TokenBucket is an in-memory Limiter that gives each key a bucket holding
+// up to burst tokens, refilled at rate tokens per second. Each allowed attempt
+// takes one token. Buckets unused for MaxIdle are forgotten. TokenBucket is
+// safe for concurrent use.
+type TokenBucket struct {
+	key     KeyFunc
+	rate    float64
+	burst   float64
+	now     func() time.Time
+	m       sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+// NewTokenBucket creates a TokenBucket keyed by key.
+func NewTokenBucket(key KeyFunc, rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		key:     key,
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the Attempt's bucket if one is available.
+func (t *TokenBucket) Allow(a *Attempt) bool {
+	k := t.key(a)
+	if k == "" {
+		return true
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	now := t.now()
+	t.calls++
+	if t.calls%pruneEvery == 0 {
+		t.prune(now)
+	}
+	b, ok := t.buckets[k]
+	if !ok {
+		b = &bucket{tokens: t.burst, last: now}
+		t.buckets[k] = b
+	}
+	t.refill(b, now)
+	b.used = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (t *TokenBucket) refill(b *bucket, now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * t.rate
+	if b.tokens > t.burst {
+		b.tokens = t.burst
+	}
+	b.last = now
+}
+
+// prune removes buckets that have refilled completely, as they're
+// equivalent to new buckets, and those unused for MaxIdle.
+func (t *TokenBucket) prune(now time.Time) {
+	for k, b := range t.buckets {
+		t.refill(b, now)
+		if b.tokens >= t.burst || now.Sub(b.used) > MaxIdle {
+			delete(t.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package limit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	tb := NewTokenBucket(BySource, 1, 2)
+	tb.now = func() time.Time { return now }
+	a := &Attempt{RemoteAddr: "192.0.2.1:1234"}
+	other := &Attempt{RemoteAddr: "192.0.2.1:5678"}
+	b := &Attempt{RemoteAddr: "192.0.2.2:1234"}
+
+	if !tb.Allow(a) || !tb.Allow(other) {
+		t.Fatal("expected burst to be allowed")
+	}
+	if tb.Allow(a) {
+		t.Fatal("expected same source on another port to share the bucket")
+	}
+	if !tb.Allow(b) {
+		t.Fatal("expected a different source to be allowed")
+	}
+	now = now.Add(time.Second)
+	if !tb.Allow(a) {
+		t.Fatal("expected token to be refilled")
+	}
+	if tb.Allow(a) {
+		t.Fatal("expected only one token to be refilled")
+	}
+}
+
+func TestEmptyKey(t *testing.T) {
+	tb := NewTokenBucket(ByAccount, 1, 1)
+	for i := 0; i < 3; i++ {
+		if !tb.Allow(&Attempt{}) {
+			t.Fatal("expected attempts without a key to be allowed")
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	tb := NewTokenBucket(ByAccount, 1, 1)
+	tb.now = func() time.Time { return now }
+	tb.Allow(&Attempt{Name: "a"})
+	now = now.Add(time.Minute)
+	tb.prune(now)
+	if len(tb.buckets) != 0 {
+		t.Fatalf("expected full buckets to be pruned, %d remain", len(tb.buckets))
+	}
+}
+
+func TestPruneIdle(t *testing.T) {
+	now := time.Now()
+	tb := NewTokenBucket(ByAccount, 0, 1)
+	tb.now = func() time.Time { return now }
+	tb.Allow(&Attempt{Name: "a"})
+	now = now.Add(time.Minute)
+	tb.Allow(&Attempt{Name: "b"})
+	now = now.Add(MaxIdle)
+	tb.prune(now)
+	if _, ok := tb.buckets["a"]; ok || len(tb.buckets) != 1 {
+		t.Fatalf("expected only the idle bucket to be pruned, %d remain", len(tb.buckets))
+	}
+	if !tb.Allow(&Attempt{Name: "a"}) {
+		t.Fatal("expected pruned bucket to allow a new attempt")
+	}
+}
@@ -0,0 +1,155 @@
+// package policy checks candidate passwords against composable rules and
+// reports every violation found in a machine-readable form that user
+// interfaces can render.
+package policy
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Violation codes reported by the rules in this package.
+const (
+	TooShort     = "too_short"           // Fewer runes than the minimum length
+	TooLong      = "too_long"            // More runes than the maximum length
+	ContainsName = "contains_name"       // Contains the account name
+	ContainsWord = "contains_word"       // Contains a context-specific word
+	Repeated     = "repeated_characters" // Too many consecutive identical characters
+)
+
+// Violation describes one way in which a password fails a Policy.
+type Violation struct {
+	Code    string // Machine-readable identifier of the failed rule
+	Message string // Human-readable description of the failure
+	Limit   int    // The limit that was exceeded, if the rule has one
+
+	Feedback []string // Further human-readable explanation and suggestions, if any
+}
+
+// Rule objects check a password for one kind of weakness. The account name
+// is supplied for rules that compare against it.
+type Rule interface {
+	Check(name, password string) ([]Violation, error)
+}
+
+// RuleFunc adapts an ordinary function to a Rule.
+type RuleFunc func(name, password string) ([]Violation, error)
+
+// Check calls f.
+func (f RuleFunc) Check(name, password string) ([]Violation, error) {
+	return f(name, password)
+}
+
+// Normalizer transforms a password into a canonical form before it is
+// checked or hashed.
+type Normalizer func(password []byte) []byte
+
+// NFKC normalizes passwords to Unicode Normalization Form KC so that
+// equivalent inputs from different keyboards and platforms match.
+func NFKC(password []byte) []byte {
+	return norm.NFKC.Bytes(password)
+}
+
+// Policy is a set of Rules applied to normalized passwords.
+type Policy struct {
+	Normalize Normalizer // Applied before checking and before hashing, if non-nil
+	Rules     []Rule     // Checked in order, stopping after a TooLong violation
+}
+
+// Default returns a Policy following common guidance: NFKC normalization,
+// 8 to 256 runes, and not containing the account name.
+func Default() *Policy {
+	return &Policy{
+		Normalize: NFKC,
+		Rules: []Rule{
+			MinLength(8),
+			MaxLength(256),
+			NotName(),
+		},
+	}
+}
+
+// Normalized returns the password as it should be checked and hashed.
+func (p *Policy) Normalized(password []byte) []byte {
+	if p == nil || p.Normalize == nil {
+		return password
+	}
+	return p.Normalize(password)
+}
+
+// Check normalizes the password and applies every Rule. If any violations
+// are found, the returned error is an *Error holding all of them. Once a rule
+// reports a TooLong violation, the remaining rules aren't checked, so costly
+// rules such as strength and breach checks needn't bound their own input as
+// long as a MaxLength rule precedes them.
+func (p *Policy) Check(name string, password []byte) error {
+	pw := string(p.Normalized(password))
+	all := []Violation{}
+	for _, r := range p.Rules {
+		v, err := r.Check(name, pw)
+		if err != nil {
+			return errors.Wrap(err, "checking password policy")
+		}
+		all = append(all, v...)
+		if tooLong(v) {
+			break
+		}
+	}
+	if len(all) > 0 {
+		return &Error{Violations: all}
+	}
+	return nil
+}
+
+func tooLong(v []Violation) bool {
+	for _, vv := range v {
+		if vv.Code == TooLong {
+			return true
+		}
+	}
+	return false
+}
+
+// Violator can be implemented by errors to indicate that a password
+// violated a policy.
+type Violator interface {
+	IsViolation() bool
+}
+
+// Error reports every Violation found when checking a password.
+type Error struct {
+	Violations []Violation
+}
+
+// Error returns the messages of all violations.
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Message
+	}
+	return "password policy violation: " + strings.Join(msgs, "; ")
+}
+
+// IsViolation indicates that a password violated a policy.
+func (e *Error) IsViolation() bool {
+	return true
+}
+
+// IsViolation checks whether or not an error indicates that a password
+// violated a policy.
+func IsViolation(err error) bool {
+	if v, ok := errors.Cause(err).(Violator); ok {
+		return v.IsViolation()
+	}
+	return false
+}
+
+// Violations returns the violations carried by an error, if any.
+func Violations(err error) []Violation {
+	if e, ok := errors.Cause(err).(*Error); ok {
+		return e.Violations
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func codes(err error) map[string]bool {
+	c := map[string]bool{}
+	for _, v := range Violations(err) {
+		c[v.Code] = true
+	}
+	return c
+}
+
+func TestCheck(t *testing.T) {
+	p := &Policy{
+		Normalize: NFKC,
+		Rules: []Rule{
+			MinLength(8),
+			MaxLength(16),
+			NotName(),
+			Words("example"),
+			MaxRepeated(2),
+		},
+	}
+	for _, tc := range []struct {
+		name, password string
+		want           []string
+	}{
+		{"alice", "a fine passphrase", []string{TooLong}},
+		// Rules after a TooLong violation aren't checked
+		{"alice", "alice's paaassword", []string{TooLong}},
+		{"alice", "ok horse", nil},
+		{"alice", "short", []string{TooShort}},
+		{"alice", "xxALICExx", []string{ContainsName}},
+		{"al", "al", []string{TooShort, ContainsName}},
+		{"al", "alalalala", nil},
+		{"alice", "myExample1", []string{ContainsWord}},
+		{"alice", "paaassword", []string{Repeated}},
+		// 8 runes, more bytes
+		{"alice", "ééééééé1", []string{Repeated}},
+		// 4 ligatures normalize to 8 runes
+		{"alice", "ﬁﬁﬁﬁ", nil},
+	} {
+		err := p.Check(tc.name, []byte(tc.password))
+		got := codes(err)
+		if len(got) != len(tc.want) {
+			t.Fatalf("%q: expected %v, got %v", tc.password, tc.want, err)
+		}
+		for _, w := range tc.want {
+			if !got[w] {
+				t.Fatalf("%q: expected %v, got %v", tc.password, tc.want, err)
+			}
+		}
+		if len(tc.want) > 0 && !IsViolation(errors.Wrap(err, "wrapped")) {
+			t.Fatalf("%q: expected violation error, got %v", tc.password, err)
+		}
+	}
+}
+
+func TestNormalized(t *testing.T) {
+	p := Default()
+	// U+212B ANGSTROM SIGN normalizes to U+00C5.
+	if got := string(p.Normalized([]byte("Å"))); got != "Å" {
+		t.Fatalf("expected normalized password, got %q", got)
+	}
+	var nilPolicy *Policy
+	if got := string(nilPolicy.Normalized([]byte("x"))); got != "x" {
+		t.Fatalf("expected nil policy to leave password unchanged, got %q", got)
+	}
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MinLength requires at least n runes.
+func MinLength(n int) Rule {
+	return RuleFunc(func(name, password string) ([]Violation, error) {
+		if utf8.RuneCountInString(password) < n {
+			return []Violation{{
+				Code:    TooShort,
+				Message: "must be at least " + strconv.Itoa(n) + " characters",
+				Limit:   n,
+			}}, nil
+		}
+		return nil, nil
+	})
+}
+
+// MaxLength allows at most n runes.
+func MaxLength(n int) Rule {
+	return RuleFunc(func(name, password string) ([]Violation, error) {
+		if utf8.RuneCountInString(password) > n {
+			return []Violation{{
+				Code:    TooLong,
+				Message: "must be at most " + strconv.Itoa(n) + " characters",
+				Limit:   n,
+			}}, nil
+		}
+		return nil, nil
+	})
+}
+
+// NotName rejects passwords containing the account name, ignoring case.
+// Names shorter than three runes are only rejected as the whole password.
+func NotName() Rule {
+	return RuleFunc(func(name, password string) ([]Violation, error) {
+		if name == "" {
+			return nil, nil
+		}
+		n, p := strings.ToLower(name), strings.ToLower(password)
+		if p == n || utf8.RuneCountInString(n) >= 3 && strings.Contains(p, n) {
+			return []Violation{{
+				Code:    ContainsName,
+				Message: "must not contain the account name",
+			}}, nil
+		}
+		return nil, nil
+	})
+}
+
+// Words rejects passwords containing any of the given context-specific
+// words, such as the name of the service, ignoring case.
+func Words(words ...string) Rule {
+	lower := make([]string, 0, len(words))
+	for _, w := range words {
+		if w != "" {
+			lower = append(lower, strings.ToLower(w))
+		}
+	}
+	return RuleFunc(func(name, password string) ([]Violation, error) {
+		p := strings.ToLower(password)
+		for _, w := range lower {
+			if strings.Contains(p, w) {
+				return []Violation{{
+					Code:    ContainsWord,
+					Message: "must not contain the word \"" + w + "\"",
+				}}, nil
+			}
+		}
+		return nil, nil
+	})
+}
+
+// MaxRepeated allows at most n consecutive identical runes.
+func MaxRepeated(n int) Rule {
+	return RuleFunc(func(name, password string) ([]Violation, error) {
+		var last rune
+		run := 0
+		for _, r := range password {
+			if run > 0 && r == last {
+				run++
+			} else {
+				last, run = r, 1
+			}
+			if run > n {
+				return []Violation{{
+					Code:    Repeated,
+					Message: "must not repeat a character more than " + strconv.Itoa(n) + " times in a row",
+					Limit:   n,
+				}}, nil
+			}
+		}
+		return nil, nil
+	})
+}
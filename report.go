@@ -0,0 +1,55 @@
+package dontusepasswords
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/AgentZombie/dontusepasswords/account"
+	"github.com/AgentZombie/dontusepasswords/auth"
+)
+
+// TypeCount is the number of accounts whose current challenge uses one auth
+// type.
+type TypeCount struct {
+	AuthType   string // The auth type, resolving aliases
+	Accounts   int    // The number of accounts using it
+	Deprecated bool   // Whether the auth type is deprecated
+	Registered bool   // Whether the auth type is registered; accounts using unregistered types can't log in
+}
+
+// Report counts the accounts using each auth type, sorted by auth type, so
+// administrators can tell how many accounts are still on deprecated or
+// legacy schemes. The Store must implement account.Lister.
+func (s Accounts) Report() ([]TypeCount, error) {
+	l, ok := s.Store.(account.Lister)
+	if !ok {
+		return nil, errors.New("account store can't list accounts")
+	}
+	names, err := l.Names()
+	if err != nil {
+		return nil, errors.Wrap(err, "listing accounts")
+	}
+	counts := map[string]int{}
+	for _, name := range names {
+		a, err := s.Store.Get(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting account "+name)
+		}
+		counts[auth.Canonical(a.AuthType)]++
+	}
+	report := make([]TypeCount, 0, len(counts))
+	for authtype, n := range counts {
+		_, registered := auth.Lookup(authtype)
+		report = append(report, TypeCount{
+			AuthType:   authtype,
+			Accounts:   n,
+			Deprecated: auth.IsDeprecated(authtype),
+			Registered: registered,
+		})
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].AuthType < report[j].AuthType
+	})
+	return report, nil
+}
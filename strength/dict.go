@@ -0,0 +1,49 @@
+package strength
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+var (
+	//go:embed dict/passwords.txt
+	passwordsList string
+	//go:embed dict/english.txt
+	englishList string
+	//go:embed dict/names.txt
+	namesList string
+
+	loadDicts sync.Once
+	defaults  []dictionary
+)
+
+// dictionary maps lower-case words to their rank, 1 being the most common.
+type dictionary struct {
+	name  string
+	ranks map[string]int
+}
+
+func parseDictionary(name, list string) dictionary {
+	d := dictionary{name: name, ranks: map[string]int{}}
+	for _, w := range strings.Split(list, "\n") {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if _, ok := d.ranks[w]; w != "" && !ok {
+			d.ranks[w] = len(d.ranks) + 1
+		}
+	}
+	return d
+}
+
+// defaultDictionaries returns the embedded dictionaries, parsing them on
+// first use.
+func defaultDictionaries() []dictionary {
+	loadDicts.Do(func() {
+		defaults = []dictionary{
+			parseDictionary("passwords", passwordsList),
+			parseDictionary("english", englishList),
+			parseDictionary("names", namesList),
+		}
+	})
+	return append([]dictionary(nil), defaults...)
+}
@@ -0,0 +1,103 @@
+package strength
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	suggestAddWord = "Add another word or two. Uncommon words are better."
+)
+
+// feedback explains the longest match of a weak password's sequence.
+func feedback(score int, seq []*Match) Feedback {
+	if len(seq) == 0 {
+		return Feedback{Suggestions: []string{
+			"Use a few words, avoid common phrases",
+			"No need for symbols, digits, or uppercase letters",
+		}}
+	}
+	if score > 2 {
+		return Feedback{}
+	}
+	longest := seq[0]
+	for _, m := range seq[1:] {
+		if len([]rune(m.Token)) > len([]rune(longest.Token)) {
+			longest = m
+		}
+	}
+	f := matchFeedback(longest, len(seq) == 1)
+	f.Suggestions = append([]string{suggestAddWord}, f.Suggestions...)
+	return f
+}
+
+func matchFeedback(m *Match, sole bool) Feedback {
+	switch m.Pattern {
+	case Dictionary:
+		return dictionaryFeedback(m, sole)
+	case Spatial:
+		w := "Straight rows of keys are easy to guess"
+		if m.Turns > 1 {
+			w = "Short keyboard patterns are easy to guess"
+		}
+		return Feedback{Warning: w, Suggestions: []string{"Use a longer keyboard pattern with more turns"}}
+	case Repeat:
+		w := `Repeats like "abcabcabc" are only slightly harder to guess than "abc"`
+		if len([]rune(m.BaseToken)) == 1 {
+			w = `Repeats like "aaa" are easy to guess`
+		}
+		return Feedback{Warning: w, Suggestions: []string{"Avoid repeated words and characters"}}
+	case Sequence:
+		return Feedback{Warning: "Sequences like abc or 6543 are easy to guess", Suggestions: []string{"Avoid sequences"}}
+	case Year:
+		return Feedback{Warning: "Recent years are easy to guess", Suggestions: []string{
+			"Avoid recent years",
+			"Avoid years that are associated with you",
+		}}
+	case Date:
+		return Feedback{Warning: "Dates are often easy to guess", Suggestions: []string{
+			"Avoid dates and years that are associated with you",
+		}}
+	}
+	return Feedback{}
+}
+
+func dictionaryFeedback(m *Match, sole bool) Feedback {
+	f := Feedback{}
+	switch m.Dictionary {
+	case "passwords":
+		switch {
+		case sole && !m.L33t && !m.Reversed && m.Rank <= 10:
+			f.Warning = "This is a top-10 common password"
+		case sole && !m.L33t && !m.Reversed && m.Rank <= 100:
+			f.Warning = "This is a top-100 common password"
+		default:
+			f.Warning = "This is similar to a commonly used password"
+		}
+	case "english":
+		if sole {
+			f.Warning = "A word by itself is easy to guess"
+		}
+	case "names":
+		if sole {
+			f.Warning = "Names and surnames by themselves are easy to guess"
+		} else {
+			f.Warning = "Common names and surnames are easy to guess"
+		}
+	case "user_inputs":
+		f.Warning = "Words related to you or this site are easy to guess"
+	}
+	runes := []rune(m.Token)
+	if unicode.IsUpper(runes[0]) && strings.ToLower(string(runes[1:])) == string(runes[1:]) {
+		f.Suggestions = append(f.Suggestions, "Capitalization doesn't help very much")
+	} else if strings.ToUpper(m.Token) == m.Token && strings.ToLower(m.Token) != m.Token {
+		f.Suggestions = append(f.Suggestions, "All-uppercase is almost as easy to guess as all-lowercase")
+	}
+	if m.Reversed && len(runes) >= 4 {
+		f.Suggestions = append(f.Suggestions, "Reversed words aren't much harder to guess")
+	}
+	if m.L33t {
+		f.Suggestions = append(f.Suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much")
+	}
+	return f
+}
@@ -0,0 +1,196 @@
+package strength
+
+import (
+	"math"
+	"unicode"
+)
+
+// estimateGuesses returns the guesses needed to find a match, caching the
+// result on the match. Matches shorter than the password are given a minimum
+// so that splitting the password into many tiny matches isn't rewarded.
+func estimateGuesses(m *Match, pwLen int, dicts []dictionary) float64 {
+	if m.Guesses != 0 {
+		return m.Guesses
+	}
+	var g float64
+	switch m.Pattern {
+	case Bruteforce:
+		g = bruteforceGuesses(m)
+	case Dictionary:
+		g = dictionaryGuesses(m)
+	case Spatial:
+		g = spatialGuesses(m)
+	case Repeat:
+		g = m.baseGuesses * float64(m.RepeatCount)
+	case Sequence:
+		g = sequenceGuesses(m)
+	case Year:
+		g = yearSpace(m.Year)
+	case Date:
+		g = yearSpace(m.Year) * 365
+		if m.Separator != "" {
+			g *= 4
+		}
+	}
+	tokenLen := len([]rune(m.Token))
+	if tokenLen < pwLen {
+		min := float64(minSubmatchGuessesMultiChar)
+		if tokenLen == 1 {
+			min = minSubmatchGuessesSingleChar
+		}
+		g = math.Max(g, min)
+	}
+	m.Guesses = g
+	return g
+}
+
+func bruteforceGuesses(m *Match) float64 {
+	n := len([]rune(m.Token))
+	g := math.Pow(bruteforceCardinality, float64(n))
+	if math.IsInf(g, 1) {
+		g = math.MaxFloat64
+	}
+	// Bruteforce must never be cheaper than the submatch minimums, or it
+	// would be preferred over them.
+	min := float64(minSubmatchGuessesMultiChar + 1)
+	if n == 1 {
+		min = minSubmatchGuessesSingleChar + 1
+	}
+	return math.Max(g, min)
+}
+
+func yearSpace(year int) float64 {
+	return math.Max(math.Abs(float64(year-referenceYear())), 20)
+}
+
+func dictionaryGuesses(m *Match) float64 {
+	g := float64(m.Rank) * uppercaseVariations(m.Token) * l33tVariations(m)
+	if m.Reversed {
+		g *= 2
+	}
+	return g
+}
+
+// uppercaseVariations estimates how many capitalizations of a word an
+// attacker would try before the one used.
+func uppercaseVariations(token string) float64 {
+	runes := []rune(token)
+	upper, lower := 0, 0
+	for _, c := range runes {
+		if unicode.IsUpper(c) {
+			upper++
+		} else if unicode.IsLower(c) {
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	// Capitalizing the first or last letter, or every letter, is common.
+	if lower == 0 ||
+		upper == 1 && (unicode.IsUpper(runes[0]) || unicode.IsUpper(runes[len(runes)-1])) {
+		return 2
+	}
+	var v float64
+	for i := 1; i <= upper && i <= lower; i++ {
+		v += nCk(upper+lower, i)
+	}
+	return v
+}
+
+// l33tVariations estimates how many combinations of substitutions an
+// attacker would try before the one used.
+func l33tVariations(m *Match) float64 {
+	if !m.L33t {
+		return 1
+	}
+	v := 1.0
+	for sub, letter := range m.Subs {
+		subbed, unsubbed := 0, 0
+		for _, c := range []rune(m.Token) {
+			c = unicode.ToLower(c)
+			if c == sub {
+				subbed++
+			} else if c == letter {
+				unsubbed++
+			}
+		}
+		if subbed == 0 || unsubbed == 0 {
+			v *= 2
+			continue
+		}
+		var p float64
+		for i := 1; i <= subbed && i <= unsubbed; i++ {
+			p += nCk(subbed+unsubbed, i)
+		}
+		v *= p
+	}
+	return v
+}
+
+func spatialGuesses(m *Match) float64 {
+	g := qwerty
+	if m.Graph == keypad.name {
+		g = keypad
+	}
+	s, d := float64(g.count), g.avgDegree
+	l := len([]rune(m.Token))
+	var guesses float64
+	for i := 2; i <= l; i++ {
+		for j := 1; j <= m.Turns && j <= i-1; j++ {
+			guesses += nCk(i-1, j-1) * s * math.Pow(d, float64(j))
+		}
+	}
+	if m.Shifted > 0 {
+		unshifted := l - m.Shifted
+		if unshifted == 0 {
+			guesses *= 2
+		} else {
+			var v float64
+			for i := 1; i <= m.Shifted && i <= unshifted; i++ {
+				v += nCk(m.Shifted+unshifted, i)
+			}
+			guesses *= v
+		}
+	}
+	return guesses
+}
+
+func sequenceGuesses(m *Match) float64 {
+	runes := []rune(m.Token)
+	var base float64
+	switch first := runes[0]; {
+	case first == 'a' || first == 'A' || first == 'z' || first == 'Z' ||
+		first == '0' || first == '1' || first == '9':
+		base = 4
+	case first >= '0' && first <= '9':
+		base = 10
+	default:
+		base = 26
+	}
+	if !m.Ascending {
+		base *= 2
+	}
+	return base * float64(len(runes))
+}
+
+func nCk(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	r := 1.0
+	for d := 1; d <= k; d++ {
+		r *= float64(n)
+		r /= float64(d)
+		n--
+	}
+	return r
+}
+
+func factorial(n int) float64 {
+	f := 1.0
+	for i := 2; i <= n; i++ {
+		f *= float64(i)
+	}
+	return f
+}
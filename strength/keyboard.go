@@ -0,0 +1,108 @@
+package strength
+
+// graph is a keyboard layout: for each key, its characters and its
+// neighbors in fixed directions, nil where there is no neighbor.
+type graph struct {
+	name      string
+	keys      map[rune]*key
+	count     int     // Number of keys
+	avgDegree float64 // Average number of neighbors per key
+}
+
+type key struct {
+	chars     string // Unshifted and shifted characters
+	neighbors []*key // Indexed by direction
+}
+
+var (
+	qwerty = newGraph("qwerty", []string{
+		"`~ 1! 2@ 3# 4$ 5% 6^ 7& 8* 9( 0) -_ =+",
+		"qQ wW eE rR tT yY uU iI oO pP [{ ]} \\|",
+		"aA sS dD fF gG hH jJ kK lL ;: '\"",
+		"zZ xX cC vV bB nN mM ,< .> /?",
+	}, true)
+	keypad = newGraph("keypad", []string{
+		"_ / * -",
+		"7 8 9 +",
+		"4 5 6 _",
+		"1 2 3 _",
+		"_ 0 . _",
+	}, false)
+	graphs = []*graph{qwerty, keypad}
+)
+
+// newGraph builds a graph from rows of space-separated keys. Slanted layouts
+// have each row offset by half a key, giving six neighbors per key; aligned
+// layouts give eight. An underscore marks an empty position.
+func newGraph(name string, rows []string, slanted bool) *graph {
+	var grid [][]*key
+	g := &graph{name: name, keys: map[rune]*key{}}
+	for _, row := range rows {
+		var keys []*key
+		for _, f := range splitFields(row) {
+			if f == "_" {
+				keys = append(keys, nil)
+				continue
+			}
+			k := &key{chars: f}
+			keys = append(keys, k)
+			for _, c := range f {
+				g.keys[c] = k
+			}
+			g.count++
+		}
+		grid = append(grid, keys)
+	}
+	var dirs [][2]int
+	if slanted {
+		dirs = [][2]int{{0, -1}, {-1, 0}, {-1, 1}, {0, 1}, {1, 0}, {1, -1}}
+	} else {
+		dirs = [][2]int{{0, -1}, {-1, -1}, {-1, 0}, {-1, 1}, {0, 1}, {1, 1}, {1, 0}, {1, -1}}
+	}
+	degrees := 0
+	for r, keys := range grid {
+		for c, k := range keys {
+			if k == nil {
+				continue
+			}
+			for _, d := range dirs {
+				var n *key
+				rr, cc := r+d[0], c+d[1]
+				if rr >= 0 && rr < len(grid) && cc >= 0 && cc < len(grid[rr]) {
+					n = grid[rr][cc]
+				}
+				if n != nil {
+					degrees++
+				}
+				k.neighbors = append(k.neighbors, n)
+			}
+		}
+	}
+	g.avgDegree = float64(degrees) / float64(g.count)
+	return g
+}
+
+func splitFields(s string) []string {
+	var fields []string
+	start := -1
+	for i, c := range s {
+		if c == ' ' {
+			if start >= 0 {
+				fields = append(fields, s[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, s[start:])
+	}
+	return fields
+}
+
+// isShifted reports whether c is the shifted character of its key.
+func (k *key) isShifted(c rune) bool {
+	runes := []rune(k.chars)
+	return len(runes) > 1 && runes[1] == c && runes[0] != c
+}
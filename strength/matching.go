@@ -0,0 +1,481 @@
+package strength
+
+import (
+	"sort"
+	"time"
+	"unicode"
+)
+
+var l33tTable = map[rune][]rune{
+	'a': {'4', '@'},
+	'b': {'8'},
+	'c': {'(', '{', '[', '<'},
+	'e': {'3'},
+	'g': {'6', '9'},
+	'i': {'1', '!', '|'},
+	'l': {'1', '|', '7'},
+	'o': {'0'},
+	's': {'$', '5'},
+	't': {'+', '7'},
+	'x': {'%'},
+	'z': {'2'},
+}
+
+// maxL33tCombinations bounds how many ways of undoing ambiguous
+// substitutions are tried.
+const maxL33tCombinations = 32
+
+// omnimatch returns every pattern found in the password.
+func omnimatch(pw []rune, dicts []dictionary) []*Match {
+	var matches []*Match
+	matches = append(matches, dictionaryMatches(pw, dicts)...)
+	matches = append(matches, reverseDictionaryMatches(pw, dicts)...)
+	matches = append(matches, l33tMatches(pw, dicts)...)
+	matches = append(matches, spatialMatches(pw)...)
+	matches = append(matches, repeatMatches(pw, dicts)...)
+	matches = append(matches, sequenceMatches(pw)...)
+	matches = append(matches, yearMatches(pw)...)
+	matches = append(matches, dateMatches(pw)...)
+	sort.SliceStable(matches, func(a, b int) bool {
+		if matches[a].I != matches[b].I {
+			return matches[a].I < matches[b].I
+		}
+		return matches[a].J < matches[b].J
+	})
+	return matches
+}
+
+func maxWordLen(dicts []dictionary) int {
+	max := 0
+	for _, d := range dicts {
+		for w := range d.ranks {
+			if n := len([]rune(w)); n > max {
+				max = n
+			}
+		}
+	}
+	return max
+}
+
+func dictionaryMatches(pw []rune, dicts []dictionary) []*Match {
+	var matches []*Match
+	lower := toLower(pw)
+	maxLen := maxWordLen(dicts)
+	for i := range lower {
+		for j := i; j < len(lower) && j-i < maxLen; j++ {
+			w := string(lower[i : j+1])
+			for _, d := range dicts {
+				if rank, ok := d.ranks[w]; ok {
+					matches = append(matches, &Match{
+						Pattern:    Dictionary,
+						I:          i,
+						J:          j,
+						Token:      string(pw[i : j+1]),
+						Dictionary: d.name,
+						Word:       w,
+						Rank:       rank,
+					})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+func reverseDictionaryMatches(pw []rune, dicts []dictionary) []*Match {
+	n := len(pw)
+	var matches []*Match
+	for _, m := range dictionaryMatches(reverse(pw), dicts) {
+		// Palindromes are already found unreversed.
+		if m.J-m.I < 1 {
+			continue
+		}
+		i, j := n-1-m.J, n-1-m.I
+		token := string(pw[i : j+1])
+		if token == m.Token {
+			continue
+		}
+		m.I, m.J, m.Token, m.Reversed = i, j, token, true
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// l33tSubTables returns the ways of mapping the substitution characters
+// present in the password back to letters.
+func l33tSubTables(pw []rune) []map[rune]rune {
+	options := map[rune][]rune{}
+	for letter, subs := range l33tTable {
+		for _, s := range subs {
+			for _, c := range pw {
+				if c == s {
+					options[s] = append(options[s], letter)
+					break
+				}
+			}
+		}
+	}
+	subs := make([]rune, 0, len(options))
+	for s, letters := range options {
+		sort.Slice(letters, func(a, b int) bool { return letters[a] < letters[b] })
+		subs = append(subs, s)
+	}
+	sort.Slice(subs, func(a, b int) bool { return subs[a] < subs[b] })
+	tables := []map[rune]rune{{}}
+	for _, s := range subs {
+		var next []map[rune]rune
+		for _, t := range tables {
+			for _, letter := range options[s] {
+				if len(next) >= maxL33tCombinations {
+					break
+				}
+				nt := map[rune]rune{s: letter}
+				for k, v := range t {
+					nt[k] = v
+				}
+				next = append(next, nt)
+			}
+		}
+		tables = next
+	}
+	if len(tables) == 1 && len(tables[0]) == 0 {
+		return nil
+	}
+	return tables
+}
+
+func l33tMatches(pw []rune, dicts []dictionary) []*Match {
+	var matches []*Match
+	seen := map[[3]int]bool{}
+	for _, table := range l33tSubTables(pw) {
+		sub := make([]rune, len(pw))
+		for i, c := range pw {
+			if l, ok := table[c]; ok {
+				sub[i] = l
+			} else {
+				sub[i] = c
+			}
+		}
+		for _, m := range dictionaryMatches(sub, dicts) {
+			token := pw[m.I : m.J+1]
+			used := map[rune]rune{}
+			for _, c := range token {
+				if l, ok := table[c]; ok {
+					used[c] = l
+				}
+			}
+			// Single characters and tokens without substitutions are
+			// covered by other matchers.
+			if len(used) == 0 || m.J == m.I {
+				continue
+			}
+			key := [3]int{m.I, m.J, m.Rank}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			m.Token = string(token)
+			m.L33t = true
+			m.Subs = used
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+func spatialMatches(pw []rune) []*Match {
+	var matches []*Match
+	for _, g := range graphs {
+		i := 0
+		for i < len(pw)-1 {
+			j := i + 1
+			lastDir := -1
+			turns := 0
+			shifted := 0
+			if k, ok := g.keys[pw[i]]; ok && k.isShifted(pw[i]) {
+				shifted = 1
+			}
+			for {
+				found := false
+				if j < len(pw) {
+					prev := g.keys[pw[j-1]]
+					cur := pw[j]
+					if prev != nil {
+						for dir, n := range prev.neighbors {
+							if n == nil || n != g.keys[cur] {
+								continue
+							}
+							found = true
+							if n.isShifted(cur) {
+								shifted++
+							}
+							if dir != lastDir {
+								turns++
+								lastDir = dir
+							}
+							break
+						}
+					}
+				}
+				if found {
+					j++
+					continue
+				}
+				if j-i > 2 {
+					matches = append(matches, &Match{
+						Pattern: Spatial,
+						I:       i,
+						J:       j - 1,
+						Token:   string(pw[i:j]),
+						Graph:   g.name,
+						Turns:   turns,
+						Shifted: shifted,
+					})
+				}
+				i = j
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// repeatMatches finds runs of a repeated unit, preferring the run covering
+// the most characters and then the shortest unit.
+func repeatMatches(pw []rune, dicts []dictionary) []*Match {
+	var matches []*Match
+	i := 0
+	for i < len(pw) {
+		bestLen, bestCount := 0, 0
+		for b := 1; i+2*b <= len(pw); b++ {
+			count := 1
+			for i+(count+1)*b <= len(pw) && equalRunes(pw[i:i+b], pw[i+count*b:i+(count+1)*b]) {
+				count++
+			}
+			if count >= 2 && b*count > bestLen*bestCount {
+				bestLen, bestCount = b, count
+			}
+		}
+		if bestCount < 2 {
+			i++
+			continue
+		}
+		base := pw[i : i+bestLen]
+		_, baseGuesses := mostGuessable(base, omnimatch(base, dicts), dicts)
+		j := i + bestLen*bestCount - 1
+		matches = append(matches, &Match{
+			Pattern:     Repeat,
+			I:           i,
+			J:           j,
+			Token:       string(pw[i : j+1]),
+			BaseToken:   string(base),
+			RepeatCount: bestCount,
+			baseGuesses: baseGuesses,
+		})
+		i = j + 1
+	}
+	return matches
+}
+
+func equalRunes(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// charClass groups characters that can form a sequence together.
+func charClass(c rune) int {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return 1
+	case c >= 'A' && c <= 'Z':
+		return 2
+	case c >= '0' && c <= '9':
+		return 3
+	}
+	return 0
+}
+
+// sequenceMatches finds runs of at least three characters of one class
+// with a constant step of at most 5, like "abc", "7531", or "ZYX".
+func sequenceMatches(pw []rune) []*Match {
+	var matches []*Match
+	i := 0
+	for i < len(pw)-2 {
+		delta := pw[i+1] - pw[i]
+		cls := charClass(pw[i])
+		if cls == 0 || delta == 0 || delta > 5 || delta < -5 {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(pw) && charClass(pw[j]) == cls && pw[j]-pw[j-1] == delta {
+			j++
+		}
+		if j-i >= 3 {
+			matches = append(matches, &Match{
+				Pattern:   Sequence,
+				I:         i,
+				J:         j - 1,
+				Token:     string(pw[i:j]),
+				Ascending: delta > 0,
+			})
+			i = j - 1
+			continue
+		}
+		i++
+	}
+	return matches
+}
+
+func isDigits(s []rune) bool {
+	for _, c := range s {
+		if !unicode.IsDigit(c) || c > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+func atoi(s []rune) int {
+	n := 0
+	for _, c := range s {
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
+
+// yearMatches finds four digit years from 1900 to 2099.
+func yearMatches(pw []rune) []*Match {
+	var matches []*Match
+	for i := 0; i+4 <= len(pw); i++ {
+		s := pw[i : i+4]
+		if !isDigits(s) || !(s[0] == '1' && s[1] == '9' || s[0] == '2' && s[1] == '0') {
+			continue
+		}
+		matches = append(matches, &Match{
+			Pattern: Year,
+			I:       i,
+			J:       i + 3,
+			Token:   string(s),
+			Year:    atoi(s),
+		})
+	}
+	return matches
+}
+
+// dateSplits lists, by length, where to split a run of digits into three
+// date parts.
+var dateSplits = map[int][][2]int{
+	4: {{1, 2}, {2, 3}},
+	5: {{1, 3}, {2, 3}},
+	6: {{1, 2}, {2, 4}, {4, 5}},
+	7: {{1, 3}, {2, 3}, {4, 5}, {4, 6}},
+	8: {{2, 4}, {4, 6}},
+}
+
+func isDateSeparator(c rune) bool {
+	switch c {
+	case ' ', '/', '\\', '_', '.', '-':
+		return true
+	}
+	return false
+}
+
+// dateMatches finds dates with or without separators, such as 13.2.1985,
+// 4/20/69, or 19851302.
+func dateMatches(pw []rune) []*Match {
+	var matches []*Match
+	for i := range pw {
+		for j := i + 3; j < len(pw) && j-i < 10; j++ {
+			token := pw[i : j+1]
+			var parts [][]rune
+			sep := ""
+			if isDigits(token) {
+				for _, split := range dateSplits[len(token)] {
+					parts = [][]rune{token[:split[0]], token[split[0]:split[1]], token[split[1]:]}
+					if year, ok := parseDate(parts); ok {
+						matches = append(matches, &Match{Pattern: Date, I: i, J: j, Token: string(token), Year: year})
+						break
+					}
+				}
+				continue
+			}
+			parts, sep = splitDate(token)
+			if parts == nil {
+				continue
+			}
+			if year, ok := parseDate(parts); ok {
+				matches = append(matches, &Match{Pattern: Date, I: i, J: j, Token: string(token), Year: year, Separator: sep})
+			}
+		}
+	}
+	return matches
+}
+
+// splitDate splits a token of the form <digits><sep><digits><sep><digits>
+// using the same separator twice.
+func splitDate(token []rune) ([][]rune, string) {
+	var parts [][]rune
+	var sep rune
+	start := 0
+	for k, c := range token {
+		if isDigits([]rune{c}) {
+			continue
+		}
+		if !isDateSeparator(c) || sep != 0 && c != sep {
+			return nil, ""
+		}
+		sep = c
+		parts = append(parts, token[start:k])
+		start = k + 1
+	}
+	parts = append(parts, token[start:])
+	if len(parts) != 3 {
+		return nil, ""
+	}
+	for _, p := range parts {
+		if len(p) == 0 || len(p) > 4 || !isDigits(p) {
+			return nil, ""
+		}
+	}
+	return parts, string(sep)
+}
+
+// parseDate interprets three numbers as day, month, and year in some order,
+// with the year first or last, and returns the year.
+func parseDate(parts [][]rune) (int, bool) {
+	n := [3]int{atoi(parts[0]), atoi(parts[1]), atoi(parts[2])}
+	for _, order := range [][3]int{{2, 0, 1}, {2, 1, 0}, {0, 1, 2}, {0, 2, 1}} {
+		y, m, d := n[order[0]], n[order[1]], n[order[2]]
+		yLen := len(parts[order[0]])
+		if yLen == 3 || yLen == 1 {
+			continue
+		}
+		if yLen == 2 {
+			if y > 50 {
+				y += 1900
+			} else {
+				y += 2000
+			}
+		}
+		if y < 1000 || y > 2050 {
+			continue
+		}
+		if m >= 1 && m <= 12 && d >= 1 && d <= 31 {
+			return y, true
+		}
+	}
+	return 0, false
+}
+
+// referenceYear is the year recent years and dates are measured from.
+func referenceYear() int {
+	return time.Now().Year()
+}
@@ -0,0 +1,35 @@
+package strength
+
+import (
+	"strconv"
+
+	"github.com/AgentZombie/dontusepasswords/policy"
+)
+
+// Weak is the policy violation code for passwords scoring below the
+// required minimum.
+const Weak = "too_weak"
+
+// Rule returns a policy.Rule rejecting passwords that score below minScore.
+// The account name and any additional user inputs, such as the name of the
+// application, are treated as easily guessed words. The violation's Feedback
+// holds the estimator's warning and suggestions.
+func Rule(minScore int, userInputs ...string) policy.Rule {
+	return policy.RuleFunc(func(name, password string) ([]policy.Violation, error) {
+		r := Estimate(password, append([]string{name}, userInputs...)...)
+		if r.Score >= minScore {
+			return nil, nil
+		}
+		fb := []string{}
+		if r.Feedback.Warning != "" {
+			fb = append(fb, r.Feedback.Warning)
+		}
+		fb = append(fb, r.Feedback.Suggestions...)
+		return []policy.Violation{{
+			Code:     Weak,
+			Message:  "is too easy to guess (strength " + strconv.Itoa(r.Score) + " of 4, " + strconv.Itoa(minScore) + " required)",
+			Limit:    minScore,
+			Feedback: fb,
+		}}, nil
+	})
+}
@@ -0,0 +1,246 @@
+// package strength estimates how many guesses an attacker would need to
+// find a password, in the style of zxcvbn. The password is broken into the
+// most guessable sequence of patterns (dictionary words, possibly reversed,
+// capitalized, or with l33t substitutions; keyboard patterns; repeats;
+// sequences; years and dates) with any remaining characters guessed by brute
+// force. The estimate is summarized as a score from 0 (too guessable) to 4
+// (very unguessable) along with feedback on how to improve the password.
+//
+// An embedded dictionary of common passwords, English words, and names is
+// used by default. Context-specific words such as the account name should be
+// supplied as user inputs.
+package strength
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Pattern names reported in Match.Pattern.
+const (
+	Dictionary = "dictionary"
+	Spatial    = "spatial"
+	Repeat     = "repeat"
+	Sequence   = "sequence"
+	Year       = "year"
+	Date       = "date"
+	Bruteforce = "bruteforce"
+)
+
+const (
+	// bruteforceCardinality is the number of guesses per brute-forced
+	// character.
+	bruteforceCardinality = 10
+
+	minSubmatchGuessesSingleChar = 10
+	minSubmatchGuessesMultiChar  = 50
+
+	// minGuessesBeforeGrowingSequence penalizes splitting a password into
+	// more matches so that, e.g., a long bruteforce run isn't cheaper than
+	// several short ones.
+	minGuessesBeforeGrowingSequence = 10000
+)
+
+// MaxLength is the number of runes of a password that are scored. Estimating
+// takes time roughly cubic in the length, and any longer password that isn't
+// guessable within its first MaxLength runes is already very unguessable.
+const MaxLength = 100
+
+// Match is one pattern found in a password.
+type Match struct {
+	Pattern string  // What kind of pattern was matched
+	I, J    int     // Indexes of the first and last runes of the match
+	Token   string  // The matched part of the password
+	Guesses float64 // Estimated guesses to find the token
+
+	Dictionary string        // For dictionary matches, which dictionary matched
+	Word       string        // For dictionary matches, the dictionary word
+	Rank       int           // For dictionary matches, the word's rank in its dictionary
+	Reversed   bool          // For dictionary matches, whether the token is the word reversed
+	L33t       bool          // For dictionary matches, whether the token uses l33t substitutions
+	Subs       map[rune]rune // For l33t matches, substituted characters and the letters they replace
+
+	Graph   string // For spatial matches, which keyboard
+	Turns   int    // For spatial matches, how many changes of direction
+	Shifted int    // For spatial matches, how many shifted characters
+
+	Ascending bool // For sequence matches, whether the sequence ascends
+
+	BaseToken   string  // For repeat matches, the repeated unit
+	RepeatCount int     // For repeat matches, how many times the unit repeats
+	baseGuesses float64 // For repeat matches, guesses to find the unit
+
+	Year      int    // For year and date matches, the year
+	Separator string // For date matches, the separator between parts
+}
+
+// Feedback explains a weak password and suggests improvements.
+type Feedback struct {
+	Warning     string   // What makes the password guessable, if anything specific
+	Suggestions []string // How to make the password stronger
+}
+
+// Result is the strength estimate of a password.
+type Result struct {
+	Guesses  float64  // Estimated guesses needed to find the password
+	Score    int      // 0 through 4, from too guessable to very unguessable
+	Sequence []*Match // The most guessable sequence of matches covering the password
+	Feedback Feedback // Explanation and suggestions for scores below 3
+}
+
+// Estimate estimates the strength of a password. User inputs are words
+// specific to the user or application, such as the account name, which are
+// treated as the most common dictionary words. Only the first MaxLength runes
+// of the password are scored.
+func Estimate(password string, userInputs ...string) *Result {
+	dicts := defaultDictionaries()
+	if len(userInputs) > 0 {
+		d := map[string]int{}
+		for i, w := range userInputs {
+			if w = strings.ToLower(w); w != "" {
+				if _, ok := d[w]; !ok {
+					d[w] = i + 1
+				}
+			}
+		}
+		dicts = append(dicts, dictionary{name: "user_inputs", ranks: d})
+	}
+	pw := []rune(password)
+	if len(pw) > MaxLength {
+		pw = pw[:MaxLength]
+	}
+	seq, guesses := mostGuessable(pw, omnimatch(pw, dicts), dicts)
+	r := &Result{
+		Guesses:  guesses,
+		Score:    score(guesses),
+		Sequence: seq,
+	}
+	r.Feedback = feedback(r.Score, seq)
+	return r
+}
+
+func score(guesses float64) int {
+	const delta = 5
+	switch {
+	case guesses < 1e3+delta:
+		return 0
+	case guesses < 1e6+delta:
+		return 1
+	case guesses < 1e8+delta:
+		return 2
+	case guesses < 1e10+delta:
+		return 3
+	}
+	return 4
+}
+
+// mostGuessable finds the sequence of non-overlapping matches, filled in with
+// bruteforce matches, that minimizes the total guesses for the password. The
+// total for a sequence of l matches is l! times the product of their guesses
+// plus a penalty for longer sequences.
+func mostGuessable(pw []rune, matches []*Match, dicts []dictionary) ([]*Match, float64) {
+	n := len(pw)
+	if n == 0 {
+		return nil, 1
+	}
+	byJ := make([][]*Match, n)
+	for _, m := range matches {
+		byJ[m.J] = append(byJ[m.J], m)
+	}
+	// For each end index k and sequence length l, the best final match,
+	// product of guesses, and total.
+	bestM := make([]map[int]*Match, n)
+	bestPi := make([]map[int]float64, n)
+	bestG := make([]map[int]float64, n)
+	for k := range bestM {
+		bestM[k] = map[int]*Match{}
+		bestPi[k] = map[int]float64{}
+		bestG[k] = map[int]float64{}
+	}
+
+	update := func(m *Match, l int) {
+		k := m.J
+		pi := estimateGuesses(m, n, dicts)
+		if l > 1 {
+			pi *= bestPi[m.I-1][l-1]
+		}
+		g := factorial(l)*pi + math.Pow(minGuessesBeforeGrowingSequence, float64(l-1))
+		for cl, cg := range bestG[k] {
+			if cl <= l && cg <= g {
+				return
+			}
+		}
+		bestM[k][l] = m
+		bestPi[k][l] = pi
+		bestG[k][l] = g
+	}
+	bruteforceUpdate := func(k int) {
+		update(bruteforceMatch(pw, 0, k), 1)
+		for i := 1; i <= k; i++ {
+			m := bruteforceMatch(pw, i, k)
+			for l, last := range bestM[i-1] {
+				// Adjacent bruteforce matches are never better than one.
+				if last.Pattern == Bruteforce {
+					continue
+				}
+				update(m, l+1)
+			}
+		}
+	}
+
+	for k := 0; k < n; k++ {
+		for _, m := range byJ[k] {
+			if m.I > 0 {
+				for l := range bestM[m.I-1] {
+					update(m, l+1)
+				}
+			} else {
+				update(m, 1)
+			}
+		}
+		bruteforceUpdate(k)
+	}
+
+	// Unwind from the end using the sequence length with the lowest total.
+	k := n - 1
+	bestL, guesses := 0, math.Inf(1)
+	for l, g := range bestG[k] {
+		if g < guesses || g == guesses && l < bestL {
+			bestL, guesses = l, g
+		}
+	}
+	seq := make([]*Match, bestL)
+	for l := bestL; l > 0; l-- {
+		m := bestM[k][l]
+		seq[l-1] = m
+		k = m.I - 1
+	}
+	return seq, guesses
+}
+
+func bruteforceMatch(pw []rune, i, j int) *Match {
+	return &Match{
+		Pattern: Bruteforce,
+		I:       i,
+		J:       j,
+		Token:   string(pw[i : j+1]),
+	}
+}
+
+// reverse returns a reversed copy of s.
+func reverse(s []rune) []rune {
+	r := make([]rune, len(s))
+	for i, c := range s {
+		r[len(s)-1-i] = c
+	}
+	return r
+}
+
+func toLower(s []rune) []rune {
+	r := make([]rune, len(s))
+	for i, c := range s {
+		r[i] = unicode.ToLower(c)
+	}
+	return r
+}
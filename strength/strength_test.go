@@ -0,0 +1,91 @@
+package strength
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/AgentZombie/dontusepasswords/policy"
+)
+
+func TestScores(t *testing.T) {
+	for _, tc := range []struct {
+		password string
+		max      int
+		pattern  string
+	}{
+		{"password", 0, Dictionary},
+		{"p@ssw0rd", 0, Dictionary},
+		{"drowssap", 0, Dictionary},
+		{"PASSWORD", 0, Dictionary},
+		{"qwertyuiop", 0, Dictionary},
+		{"zxcvbnm,./", 1, Spatial},
+		{"abcdefgh", 0, Sequence},
+		{"aaaaaaaaaa", 0, Repeat},
+		{"13.2.1985", 1, Date},
+		{"2019", 0, Year},
+	} {
+		r := Estimate(tc.password)
+		if r.Score > tc.max {
+			t.Fatalf("%q: expected score at most %d, got %d", tc.password, tc.max, r.Score)
+		}
+		if len(r.Sequence) != 1 || r.Sequence[0].Pattern != tc.pattern {
+			t.Fatalf("%q: expected a single %s match, got %+v", tc.password, tc.pattern, r.Sequence)
+		}
+		if r.Feedback.Warning == "" || len(r.Feedback.Suggestions) == 0 {
+			t.Fatalf("%q: expected feedback, got %+v", tc.password, r.Feedback)
+		}
+	}
+}
+
+func TestStrong(t *testing.T) {
+	for _, pw := range []string{
+		"correct horse battery staple",
+		"a8Kq!2zLp#9vR",
+	} {
+		r := Estimate(pw)
+		if r.Score != 4 {
+			t.Fatalf("%q: expected score 4, got %d", pw, r.Score)
+		}
+		if r.Feedback.Warning != "" || len(r.Feedback.Suggestions) != 0 {
+			t.Fatalf("%q: expected no feedback, got %+v", pw, r.Feedback)
+		}
+	}
+}
+
+func TestUserInputs(t *testing.T) {
+	without := Estimate("zorblaxian")
+	with := Estimate("zorblaxian", "Zorblaxian")
+	if with.Guesses >= without.Guesses || with.Score != 0 {
+		t.Fatalf("expected user input to weaken password: %g/%d vs %g/%d",
+			with.Guesses, with.Score, without.Guesses, without.Score)
+	}
+}
+
+func TestLong(t *testing.T) {
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*"
+	rnd := rand.New(rand.NewSource(1))
+	pw := make([]byte, 10000)
+	for i := range pw {
+		pw[i] = chars[rnd.Intn(len(chars))]
+	}
+	start := time.Now()
+	r := Estimate(string(pw))
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expected long password to be estimated quickly, took %v", d)
+	}
+	if r.Score != 4 {
+		t.Fatalf("expected score 4, got %d", r.Score)
+	}
+}
+
+func TestRule(t *testing.T) {
+	p := &policy.Policy{Rules: []policy.Rule{Rule(3)}}
+	v := policy.Violations(p.Check("user", []byte("Password1!")))
+	if len(v) != 1 || v[0].Code != Weak || len(v[0].Feedback) == 0 {
+		t.Fatalf("expected weak violation with feedback, got %+v", v)
+	}
+	if err := p.Check("user", []byte("correct horse battery staple")); err != nil {
+		t.Fatalf("expected strong password to pass, got %q", err)
+	}
+}